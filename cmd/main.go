@@ -1,16 +1,67 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/vd09-projects/my-documentdb-system/internal/db"
 	"github.com/vd09-projects/my-documentdb-system/internal/handlers"
+	"github.com/vd09-projects/my-documentdb-system/internal/jobs"
+	"github.com/vd09-projects/my-documentdb-system/internal/parsers"
 )
 
 func main() {
 	db.ConnectMongoDB("mongodb://db:27017")
 
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	if err := db.EnsureIndexes(ctx); err != nil {
+		log.Fatalf("Failed to create indexes: %v", err)
+	}
+	cancel()
+
+	// Number of valid records written per bulk insert during uploads
+	if batchSize, err := strconv.Atoi(os.Getenv("UPLOAD_BATCH_SIZE")); err == nil && batchSize > 0 {
+		parsers.BatchSize = batchSize
+	}
+
+	// Largest upload request in bytes for users without their own limit
+	if maxSize, err := strconv.ParseInt(os.Getenv("MAX_UPLOAD_SIZE"), 10, 64); err == nil && maxSize > 0 {
+		handlers.DefaultMaxUploadSize = maxSize
+	}
+	// Per-user upload limits, e.g. USER_MAX_UPLOAD_SIZES=alice=1073741824,bob=52428800
+	userSizes, err := handlers.ParseUserUploadSizes(os.Getenv("USER_MAX_UPLOAD_SIZES"))
+	if err != nil {
+		log.Fatalf("Invalid USER_MAX_UPLOAD_SIZES: %v", err)
+	}
+	handlers.UserMaxUploadSizes = userSizes
+
+	// Largest number of records a re-ingestion switches in its single publish transaction
+	if maxRecords, err := strconv.ParseInt(os.Getenv("MAX_REINGEST_RECORDS"), 10, 64); err == nil && maxRecords > 0 {
+		db.MaxPublishRecords = maxRecords
+	}
+
+	// Re-ingestions interrupted by a restart are rolled back before new jobs run
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Minute)
+	if err := handlers.RecoverReingestions(ctx); err != nil {
+		log.Printf("Failed to recover interrupted re-ingestions: %v", err)
+	}
+	cancel()
+
+	// Uploads are parsed in the background by a bounded pool of workers
+	workers := 4
+	if n, err := strconv.Atoi(os.Getenv("UPLOAD_WORKERS")); err == nil && n > 0 {
+		workers = n
+	}
+	jobs.StartUploadWorkers(workers, 100)
+	jobs.StartRevalidationWorkers(1, 10)
+
+	// Resumable uploads that stop receiving chunks are deleted after a day
+	go handlers.PurgeExpiredUploadSessions(time.Hour)
+
 	// Serve static
 	fs := http.FileServer(http.Dir("./static"))
 	http.Handle("/", fs)
@@ -21,6 +72,40 @@ func main() {
 
 	// Protected routes
 	http.Handle("/upload", handlers.AuthMiddleware(http.HandlerFunc(handlers.UploadHandler)))
+	http.Handle("POST /upload/sessions", handlers.AuthMiddleware(http.HandlerFunc(handlers.CreateUploadSessionHandler)))
+	http.Handle("GET /upload/sessions/{id}", handlers.AuthMiddleware(http.HandlerFunc(handlers.GetUploadSessionHandler)))
+	http.Handle("PATCH /upload/sessions/{id}", handlers.AuthMiddleware(http.HandlerFunc(handlers.AppendUploadSessionHandler)))
+	http.Handle("DELETE /upload/sessions/{id}", handlers.AuthMiddleware(http.HandlerFunc(handlers.DeleteUploadSessionHandler)))
+	http.Handle("GET /uploads", handlers.AuthMiddleware(http.HandlerFunc(handlers.ListUploadsHandler)))
+	http.Handle("DELETE /uploads/{id}", handlers.AuthMiddleware(http.HandlerFunc(handlers.RollbackUploadHandler)))
+	http.Handle("GET /uploads/{id}", handlers.AuthMiddleware(http.HandlerFunc(handlers.UploadStatusHandler)))
+	http.Handle("GET /uploads/{id}/errors", handlers.AuthMiddleware(http.HandlerFunc(handlers.UploadErrorReportHandler)))
+	http.Handle("POST /uploads/{id}/reingest", handlers.AuthMiddleware(http.HandlerFunc(handlers.ReingestUploadHandler)))
+	http.Handle("POST /uploads/{id}/cancel", handlers.AuthMiddleware(http.HandlerFunc(handlers.CancelUploadHandler)))
+	http.Handle("GET /schemas", handlers.AuthMiddleware(http.HandlerFunc(handlers.ListSchemasHandler)))
+	http.Handle("GET /schemas/{recordType}", handlers.AuthMiddleware(http.HandlerFunc(handlers.GetSchemaHandler)))
+	http.Handle("PUT /schemas/{recordType}", handlers.AuthMiddleware(http.HandlerFunc(handlers.PutSchemaHandler)))
+	http.Handle("DELETE /schemas/{recordType}", handlers.AuthMiddleware(http.HandlerFunc(handlers.DeleteSchemaHandler)))
+	http.Handle("GET /schemas/{recordType}/versions", handlers.AuthMiddleware(http.HandlerFunc(handlers.ListSchemaVersionsHandler)))
+	http.Handle("GET /schemas/{recordType}/versions/{version}", handlers.AuthMiddleware(http.HandlerFunc(handlers.GetSchemaVersionHandler)))
+	http.Handle("GET /schemas/{recordType}/compare", handlers.AuthMiddleware(http.HandlerFunc(handlers.CompareSchemaVersionsHandler)))
+	http.Handle("GET /recordTypes/{recordType}/naturalKey", handlers.AuthMiddleware(http.HandlerFunc(handlers.GetNaturalKeyHandler)))
+	http.Handle("PUT /recordTypes/{recordType}/naturalKey", handlers.AuthMiddleware(http.HandlerFunc(handlers.PutNaturalKeyHandler)))
+	http.Handle("DELETE /recordTypes/{recordType}/naturalKey", handlers.AuthMiddleware(http.HandlerFunc(handlers.DeleteNaturalKeyHandler)))
+	http.Handle("GET /recordTypes/{recordType}/transforms", handlers.AuthMiddleware(http.HandlerFunc(handlers.GetTransformsHandler)))
+	http.Handle("PUT /recordTypes/{recordType}/transforms", handlers.AuthMiddleware(http.HandlerFunc(handlers.PutTransformsHandler)))
+	http.Handle("DELETE /recordTypes/{recordType}/transforms", handlers.AuthMiddleware(http.HandlerFunc(handlers.DeleteTransformsHandler)))
+	http.Handle("GET /recordTypes/{recordType}/eventTime", handlers.AuthMiddleware(http.HandlerFunc(handlers.GetEventTimeHandler)))
+	http.Handle("PUT /recordTypes/{recordType}/eventTime", handlers.AuthMiddleware(http.HandlerFunc(handlers.PutEventTimeHandler)))
+	http.Handle("DELETE /recordTypes/{recordType}/eventTime", handlers.AuthMiddleware(http.HandlerFunc(handlers.DeleteEventTimeHandler)))
+	http.Handle("GET /quarantine", handlers.AuthMiddleware(http.HandlerFunc(handlers.ListQuarantineHandler)))
+	http.Handle("POST /quarantine/revalidations", handlers.AuthMiddleware(http.HandlerFunc(handlers.RevalidateQuarantineHandler)))
+	http.Handle("GET /quarantine/revalidations/{id}", handlers.AuthMiddleware(http.HandlerFunc(handlers.RevalidationStatusHandler)))
+	http.Handle("POST /quarantine/revalidations/{id}/cancel", handlers.AuthMiddleware(http.HandlerFunc(handlers.CancelRevalidationHandler)))
+	http.Handle("GET /quarantine/{id}", handlers.AuthMiddleware(http.HandlerFunc(handlers.GetQuarantineHandler)))
+	http.Handle("PUT /quarantine/{id}", handlers.AuthMiddleware(http.HandlerFunc(handlers.UpdateQuarantineHandler)))
+	http.Handle("POST /quarantine/{id}/resubmit", handlers.AuthMiddleware(http.HandlerFunc(handlers.ResubmitQuarantineHandler)))
+	http.Handle("DELETE /quarantine/{id}", handlers.AuthMiddleware(http.HandlerFunc(handlers.DeleteQuarantineHandler)))
 	// http.Handle("/data", handlers.AuthMiddleware(http.HandlerFunc(handlers.GetAllDataHandler)))
 	http.Handle("/userData", handlers.AuthMiddleware(http.HandlerFunc(handlers.GetUserDataHandler)))
 
@@ -2,9 +2,11 @@ package db
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -16,6 +18,15 @@ const ValidCollection = "valid_records"
 const QuarantineCollection = "quarantine_records"
 const RecordFieldsCollection = "record_fields"
 const UsersCollection = "users"
+const RecordSchemasCollection = "record_schemas"
+const RecordTypeConfigsCollection = "record_type_configs"
+const UploadsCollection = "uploads"
+const UploadFilesBucket = "upload_files"
+const UploadSessionsCollection = "upload_sessions"
+
+// Re-ingested uploads are written to staging collections and swapped in once parsing succeeds
+const StagingValidCollection = "staging_valid_records"
+const StagingQuarantineCollection = "staging_quarantine_records"
 
 func ConnectMongoDB(uri string) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -35,3 +46,67 @@ func ConnectMongoDB(uri string) {
 	log.Println("Connected to MongoDB!")
 	MongoClient = client
 }
+
+// EnsureIndexes creates the indexes the application relies on for uniqueness and lookups.
+func EnsureIndexes(ctx context.Context) error {
+	database := MongoClient.Database(DatabaseName)
+	indexes := []struct {
+		collection string
+		index      mongo.IndexModel
+	}{
+		// Schema versions are numbered per record type
+		{RecordSchemasCollection, mongo.IndexModel{
+			Keys:    bson.D{{Key: "userID", Value: 1}, {Key: "recordType", Value: 1}, {Key: "version", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		}},
+		// Records of a record type with a natural key are stored once per key
+		{ValidCollection, mongo.IndexModel{
+			Keys: bson.D{{Key: "userID", Value: 1}, {Key: "recordType", Value: 1}, {Key: "naturalKey", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"naturalKey": bson.M{"$exists": true}}),
+		}},
+		// Rolling back an upload finds its records by batch
+		{ValidCollection, mongo.IndexModel{
+			Keys: bson.D{{Key: "userID", Value: 1}, {Key: "provenance.batchID", Value: 1}},
+		}},
+		// Error reports list a batch's quarantined records by archive entry and row
+		{QuarantineCollection, mongo.IndexModel{
+			Keys: bson.D{{Key: "userID", Value: 1}, {Key: "provenance.batchID", Value: 1}, {Key: "provenance.entry", Value: 1}, {Key: "provenance.row", Value: 1}},
+		}},
+		{StagingValidCollection, mongo.IndexModel{
+			Keys: bson.D{{Key: "userID", Value: 1}, {Key: "provenance.batchID", Value: 1}},
+		}},
+		{StagingQuarantineCollection, mongo.IndexModel{
+			Keys: bson.D{{Key: "userID", Value: 1}, {Key: "provenance.batchID", Value: 1}},
+		}},
+		// Records are filtered by event time within a record type
+		{ValidCollection, mongo.IndexModel{
+			Keys: bson.D{{Key: "userID", Value: 1}, {Key: "recordType", Value: 1}, {Key: "eventTime", Value: 1}},
+		}},
+		{RecordTypeConfigsCollection, mongo.IndexModel{
+			Keys:    bson.D{{Key: "userID", Value: 1}, {Key: "recordType", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		}},
+		// Resumable uploads write GridFS chunks directly, before the driver has created this index
+		{UploadFilesBucket + ".chunks", mongo.IndexModel{
+			Keys:    bson.D{{Key: "files_id", Value: 1}, {Key: "n", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		}},
+		// Expired upload sessions are swept by expiry time
+		{UploadSessionsCollection, mongo.IndexModel{
+			Keys: bson.D{{Key: "expiresAt", Value: 1}},
+		}},
+		// A repeated upload is recognised by its dedupe key
+		{UploadsCollection, mongo.IndexModel{
+			Keys: bson.D{{Key: "userID", Value: 1}, {Key: "dedupeKey", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"dedupeKey": bson.M{"$exists": true}}),
+		}},
+	}
+	for _, idx := range indexes {
+		if _, err := database.Collection(idx.collection).Indexes().CreateOne(ctx, idx.index); err != nil {
+			return fmt.Errorf("failed to create index on %s: %w", idx.collection, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FileDB keeps uploaded files in GridFS so they can be ingested again later.
+type FileDB struct {
+	bucket *gridfs.Bucket
+	// Resumable uploads write the bucket's collections directly, see AppendChunks
+	filesColl  *mongo.Collection
+	chunksColl *mongo.Collection
+}
+
+func NewFileDB(client *mongo.Client, dbName string) (*FileDB, error) {
+	database := client.Database(dbName)
+	bucket, err := gridfs.NewBucket(database, options.GridFSBucket().SetName(UploadFilesBucket))
+	if err != nil {
+		return nil, err
+	}
+	return &FileDB{
+		bucket:     bucket,
+		filesColl:  database.Collection(UploadFilesBucket + ".files"),
+		chunksColl: database.Collection(UploadFilesBucket + ".chunks"),
+	}, nil
+}
+
+// SaveFile streams a file into GridFS and returns its ID. The file is linked to its upload
+// through the metadata.
+func (f *FileDB) SaveFile(fileName, userID, uploadID string, source io.Reader) (primitive.ObjectID, error) {
+	opts := options.GridFSUpload().SetMetadata(bson.M{
+		"userID":   userID,
+		"uploadID": uploadID,
+	})
+	return f.bucket.UploadFromStream(fileName, source, opts)
+}
+
+// OpenFile opens a stored file for reading. The caller must close it.
+func (f *FileDB) OpenFile(fileID primitive.ObjectID) (io.ReadCloser, error) {
+	return f.bucket.OpenDownloadStream(fileID)
+}
+
+func (f *FileDB) DeleteFile(ctx context.Context, fileID primitive.ObjectID) error {
+	return f.bucket.DeleteContext(ctx, fileID)
+}
+
+// AppendChunks writes the bytes of source to the file being assembled under fileID, starting
+// at offset, in GridFS chunks. The file only becomes readable once FinishChunkedFile is called.
+// Every byte read is stored before a read error is returned, and is also written to stored,
+// so a dropped connection keeps what arrived. It returns the number of bytes stored.
+func (f *FileDB) AppendChunks(ctx context.Context, fileID primitive.ObjectID, offset int64, source io.Reader, stored io.Writer) (int64, error) {
+	chunkSize := int64(gridfs.DefaultChunkSize)
+	n := offset / chunkSize
+	buf := make([]byte, chunkSize)
+
+	// A partly filled last chunk is completed rather than followed by a short one
+	filled := int(offset % chunkSize)
+	if filled > 0 {
+		var chunk struct {
+			Data []byte `bson:"data"`
+		}
+		err := f.chunksColl.FindOne(ctx, bson.M{"files_id": fileID, "n": n}).Decode(&chunk)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read chunk %d: %w", n, err)
+		}
+		if len(chunk.Data) < filled {
+			return 0, fmt.Errorf("chunk %d is shorter than the offset", n)
+		}
+		copy(buf, chunk.Data[:filled])
+	}
+
+	var written int64
+	for {
+		start := filled
+		read, readErr := io.ReadFull(source, buf[filled:])
+		filled += read
+		if filled > start {
+			_, err := f.chunksColl.UpdateOne(ctx,
+				bson.M{"files_id": fileID, "n": n},
+				bson.M{"$set": bson.M{"data": buf[:filled]}},
+				options.Update().SetUpsert(true),
+			)
+			if err != nil {
+				return written, fmt.Errorf("failed to store chunk %d: %w", n, err)
+			}
+			stored.Write(buf[start:filled])
+			written += int64(filled - start)
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			return written, nil
+		}
+		if readErr != nil {
+			return written, readErr
+		}
+		n++
+		filled = 0
+	}
+}
+
+// FinishChunkedFile makes a file written with AppendChunks readable. It can be called again,
+// e.g. to retry after a failure.
+func (f *FileDB) FinishChunkedFile(ctx context.Context, fileID primitive.ObjectID, fileName, userID, uploadID string, length int64) error {
+	_, err := f.filesColl.UpdateOne(ctx,
+		bson.M{"_id": fileID},
+		bson.M{"$set": bson.M{
+			"length":     length,
+			"chunkSize":  gridfs.DefaultChunkSize,
+			"uploadDate": time.Now(),
+			"filename":   fileName,
+			"metadata": bson.M{
+				"userID":   userID,
+				"uploadID": uploadID,
+			},
+		}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
@@ -0,0 +1,254 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/vd09-projects/my-documentdb-system/internal/models"
+	"github.com/vd09-projects/my-documentdb-system/internal/utils"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// QuarantineDB reads back quarantined records so they can be reviewed, fixed and promoted.
+type QuarantineDB struct {
+	quarColl *mongo.Collection
+	records  *RecordDB
+}
+
+func NewQuarantineDB(client *mongo.Client, dbName string) *QuarantineDB {
+	return &QuarantineDB{
+		quarColl: client.Database(dbName).Collection(QuarantineCollection),
+		records:  NewRecordDB(client, dbName),
+	}
+}
+
+// QuarantineFilter narrows a quarantine listing. Empty fields match everything.
+type QuarantineFilter struct {
+	RecordType string
+	// Reason matches reasons containing the text, ignoring case.
+	Reason string
+	// Code matches an error code exactly, e.g. models.ErrorSchemaViolation.
+	Code     string
+	From, To *time.Time
+}
+
+func (f QuarantineFilter) toBSON(userID string) bson.M {
+	filter := bson.M{
+		"userID": userID,
+	}
+	if f.RecordType != "" {
+		filter["recordType"] = f.RecordType
+	}
+	if f.Reason != "" {
+		filter["reason"] = primitive.Regex{Pattern: regexp.QuoteMeta(f.Reason), Options: "i"}
+	}
+	if f.Code != "" {
+		filter["errorCode"] = f.Code
+	}
+	dateFilter := bson.M{}
+	if f.From != nil {
+		dateFilter["$gte"] = *f.From
+	}
+	if f.To != nil {
+		dateFilter["$lte"] = *f.To
+	}
+	if len(dateFilter) > 0 {
+		filter["timestamp"] = dateFilter
+	}
+	return filter
+}
+
+// ListQuarantine returns a page of the user's quarantined records, newest first, and the
+// total number of records matching the filter.
+func (q *QuarantineDB) ListQuarantine(ctx context.Context, userID string, filter QuarantineFilter, limit, offset int64) ([]models.QuarantineRecord, int64, error) {
+	query := filter.toBSON(userID)
+	total, err := q.quarColl.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(offset).
+		SetLimit(limit)
+	cursor, err := q.quarColl.Find(ctx, query, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	records := []models.QuarantineRecord{}
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, 0, err
+	}
+	for i := range records {
+		records[i].Data = utils.FromBSON(records[i].Data)
+	}
+	return records, total, nil
+}
+
+// GetQuarantine returns one quarantined record, or nil if the user has no record with that ID.
+func (q *QuarantineDB) GetQuarantine(ctx context.Context, userID string, id primitive.ObjectID) (*models.QuarantineRecord, error) {
+	var record models.QuarantineRecord
+	err := q.quarColl.FindOne(ctx, bson.M{"_id": id, "userID": userID}).Decode(&record)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	record.Data = utils.FromBSON(record.Data)
+	return &record, nil
+}
+
+// UpdateQuarantineData replaces the data of a quarantined record. It reports whether the record exists.
+func (q *QuarantineDB) UpdateQuarantineData(ctx context.Context, userID string, id primitive.ObjectID, data interface{}) (bool, error) {
+	res, err := q.quarColl.UpdateOne(ctx,
+		bson.M{"_id": id, "userID": userID},
+		bson.M{"$set": bson.M{"data": data}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// UpdateQuarantineError records why a quarantined record failed its latest validation.
+func (q *QuarantineDB) UpdateQuarantineError(ctx context.Context, userID string, id primitive.ObjectID, recordErr models.RecordError) error {
+	update := bson.M{
+		"$set": bson.M{"errorCode": recordErr.Code, "reason": recordErr.Reason},
+	}
+	if recordErr.Field != "" {
+		update["$set"].(bson.M)["field"] = recordErr.Field
+	} else {
+		update["$unset"] = bson.M{"field": ""}
+	}
+	_, err := q.quarColl.UpdateOne(ctx, bson.M{"_id": id, "userID": userID}, update)
+	return err
+}
+
+// DeleteQuarantine discards a quarantined record. It reports whether the record existed.
+func (q *QuarantineDB) DeleteQuarantine(ctx context.Context, userID string, id primitive.ObjectID) (bool, error) {
+	res, err := q.quarColl.DeleteOne(ctx, bson.M{"_id": id, "userID": userID})
+	if err != nil {
+		return false, err
+	}
+	return res.DeletedCount > 0, nil
+}
+
+// PromoteQuarantine moves a quarantined record that now passes validation into valid_records.
+// The quarantine entry is taken first so concurrent promotions store the record only once;
+// it is restored if the valid insert fails. It reports false if the record no longer exists.
+func (q *QuarantineDB) PromoteQuarantine(ctx context.Context, record models.QuarantineRecord, valid ValidRecord) (bool, error) {
+	return q.RequeueQuarantine(ctx, record.UserID, record.ID, func(models.QuarantineRecord) error {
+		if err := q.records.InsertToValid(ctx, valid, record.UserID, record.RecordType); err != nil {
+			return fmt.Errorf("failed to promote record %s: %w", record.ID.Hex(), err)
+		}
+		return nil
+	})
+}
+
+// EachQuarantine calls fn for every quarantined record of a record type, oldest first, reading
+// them through a single cursor.
+func (q *QuarantineDB) EachQuarantine(ctx context.Context, userID, recordType string, fn func(record models.QuarantineRecord) error) error {
+	filter := bson.M{
+		"userID":     userID,
+		"recordType": recordType,
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	cursor, err := q.quarColl.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var record models.QuarantineRecord
+		if err := cursor.Decode(&record); err != nil {
+			return err
+		}
+		record.Data = utils.FromBSON(record.Data)
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// EachBatchQuarantine calls fn for every quarantined record of an upload batch, in row order
+// within each archive entry.
+func (q *QuarantineDB) EachBatchQuarantine(ctx context.Context, userID, batchID string, fn func(record models.QuarantineRecord) error) error {
+	filter := bson.M{
+		"userID":             userID,
+		"provenance.batchID": batchID,
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "provenance.entry", Value: 1}, {Key: "provenance.row", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := q.quarColl.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var record models.QuarantineRecord
+		if err := cursor.Decode(&record); err != nil {
+			return err
+		}
+		record.Data = utils.FromBSON(record.Data)
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// TakeQuarantine removes a quarantined record and returns it, or nil if it no longer exists.
+// Callers that fail to store the record elsewhere put it back with RestoreQuarantine.
+func (q *QuarantineDB) TakeQuarantine(ctx context.Context, userID string, id primitive.ObjectID) (*models.QuarantineRecord, error) {
+	var record models.QuarantineRecord
+	err := q.quarColl.FindOneAndDelete(ctx, bson.M{"_id": id, "userID": userID}).Decode(&record)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	record.Data = utils.FromBSON(record.Data)
+	return &record, nil
+}
+
+// RestoreQuarantine puts back a record removed by TakeQuarantine, keeping its ID and timestamp.
+func (q *QuarantineDB) RestoreQuarantine(ctx context.Context, record models.QuarantineRecord) error {
+	_, err := q.quarColl.InsertOne(ctx, record)
+	return err
+}
+
+// restoreAfter restores a taken record after err and returns err, noting a failed restore.
+func (q *QuarantineDB) restoreAfter(record models.QuarantineRecord, err error) error {
+	// The caller's context may be what failed
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if restoreErr := q.RestoreQuarantine(ctx, record); restoreErr != nil {
+		return fmt.Errorf("%w (restoring it to quarantine also failed: %v)", err, restoreErr)
+	}
+	return err
+}
+
+// RequeueQuarantine takes a quarantined record and hands it to store, which must write it to
+// valid_records or back to quarantine_records. The record is restored if store fails.
+// It reports false if the record no longer exists.
+func (q *QuarantineDB) RequeueQuarantine(ctx context.Context, userID string, id primitive.ObjectID, store func(record models.QuarantineRecord) error) (bool, error) {
+	taken, err := q.TakeQuarantine(ctx, userID, id)
+	if err != nil || taken == nil {
+		return false, err
+	}
+	if err := store(*taken); err != nil {
+		return false, q.restoreAfter(*taken, err)
+	}
+	return true, nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/vd09-projects/my-documentdb-system/internal/models"
 	"github.com/vd09-projects/my-documentdb-system/internal/utils"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -17,6 +18,8 @@ type RecordDB struct {
 	validColl    *mongo.Collection
 	quarColl     *mongo.Collection
 	recordFields *mongo.Collection
+	// staging is set for a RecordDB writing to the staging collections
+	staging bool
 }
 
 func NewRecordDB(client *mongo.Client, dbName string) *RecordDB {
@@ -29,21 +32,117 @@ func NewRecordDB(client *mongo.Client, dbName string) *RecordDB {
 	}
 }
 
-func (m *RecordDB) InsertToValid(ctx context.Context, data interface{}, userID string, recordType string) error {
-	_, err := m.validColl.InsertOne(ctx, bson.M{
-		"data":       data,
-		"userID":     userID,
-		"recordType": recordType,
-		"timestamp":  time.Now(),
-	})
+// NewStagingRecordDB returns a RecordDB that writes valid and quarantined records to the
+// staging collections, where they stay hidden until PublishStagedBatch moves them. Field
+// paths still go to record_fields.
+func NewStagingRecordDB(client *mongo.Client, dbName string) *RecordDB {
+	m := NewRecordDB(client, dbName)
+	m.validColl = client.Database(dbName).Collection(StagingValidCollection)
+	m.quarColl = client.Database(dbName).Collection(StagingQuarantineCollection)
+	m.staging = true
+	return m
+}
+
+func (m *RecordDB) InsertToValid(ctx context.Context, record ValidRecord, userID string, recordType string) error {
+	doc := validDocument(record, userID, recordType, time.Now())
+	var err error
+	if record.NaturalKey != "" {
+		_, err = m.validColl.ReplaceOne(ctx, m.naturalKeyFilter(record, userID, recordType), doc, options.Replace().SetUpsert(true))
+	} else {
+		_, err = m.validColl.InsertOne(ctx, doc)
+	}
 	if err != nil {
 		return err
 	}
 
-	return m.InsertToRecordFields(ctx, data, userID, recordType)
+	return m.InsertToRecordFields(ctx, record.Data, userID, recordType)
+}
+
+// validDocument builds the valid_records document of a record. Records validated against
+// a schema are stamped with its version.
+func validDocument(record ValidRecord, userID, recordType string, now time.Time) bson.M {
+	doc := bson.M{
+		"data":       record.Data,
+		"userID":     userID,
+		"recordType": recordType,
+		"timestamp":  now,
+	}
+	if record.SchemaVersion > 0 {
+		doc["schemaVersion"] = record.SchemaVersion
+	}
+	if record.NaturalKey != "" {
+		doc["naturalKey"] = record.NaturalKey
+	}
+	if record.Provenance != nil {
+		doc["provenance"] = record.Provenance
+	}
+	if record.EventTime != nil {
+		doc["eventTime"] = *record.EventTime
+	}
+	return doc
+}
+
+func (m *RecordDB) naturalKeyFilter(record ValidRecord, userID, recordType string) bson.M {
+	filter := bson.M{
+		"userID":     userID,
+		"recordType": recordType,
+		"naturalKey": record.NaturalKey,
+	}
+	// Staged batches must not replace each other's records
+	if m.staging && record.Provenance != nil {
+		filter["provenance.batchID"] = record.Provenance.BatchID
+	}
+	return filter
+}
+
+// InsertManyToValid stores a batch of records with a single bulk write and merges the
+// field paths of the whole batch into record_fields with a single upsert. Records with a
+// natural key are upserted; when a batch repeats a key, the last record wins.
+func (m *RecordDB) InsertManyToValid(ctx context.Context, records []ValidRecord, userID string, recordType string) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	writes := make([]mongo.WriteModel, 0, len(records))
+	fieldSet := make(map[string]struct{})
+	fields := []string{}
+	for _, record := range records {
+		doc := validDocument(record, userID, recordType, now)
+		if record.NaturalKey != "" {
+			writes = append(writes, mongo.NewReplaceOneModel().
+				SetFilter(m.naturalKeyFilter(record, userID, recordType)).
+				SetReplacement(doc).
+				SetUpsert(true))
+		} else {
+			writes = append(writes, mongo.NewInsertOneModel().SetDocument(doc))
+		}
+		for _, field := range utils.TraverseDynamicJSON(record.Data) {
+			if _, seen := fieldSet[field]; !seen {
+				fieldSet[field] = struct{}{}
+				fields = append(fields, field)
+			}
+		}
+	}
+
+	// Ordered, so a key repeated within the batch is applied in file order
+	if _, err := m.validColl.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(true)); err != nil {
+		return fmt.Errorf("failed to insert %d records for userID %s and recordType %s: %w", len(writes), userID, recordType, err)
+	}
+
+	return m.upsertRecordFields(ctx, fields, userID, recordType)
 }
 
 func (m *RecordDB) InsertToRecordFields(ctx context.Context, data interface{}, userID string, recordType string) error {
+	return m.upsertRecordFields(ctx, utils.TraverseDynamicJSON(data), userID, recordType)
+}
+
+func (m *RecordDB) upsertRecordFields(ctx context.Context, fields []string, userID string, recordType string) error {
+	// $each rejects null, so an empty record still needs an empty array
+	if fields == nil {
+		fields = []string{}
+	}
+
 	// Step 1: Define the filter to find the document with the given userID and recordType
 	filter := bson.M{
 		"userID":     userID,
@@ -54,7 +153,7 @@ func (m *RecordDB) InsertToRecordFields(ctx context.Context, data interface{}, u
 	update := bson.M{
 		"$addToSet": bson.M{
 			"fields": bson.M{
-				"$each": utils.TraverseDynamicJSON(data),
+				"$each": fields,
 			},
 		},
 	}
@@ -71,14 +170,22 @@ func (m *RecordDB) InsertToRecordFields(ctx context.Context, data interface{}, u
 	return nil
 }
 
-func (m *RecordDB) InsertToQuarantine(ctx context.Context, data interface{}, userID string, recordType string, reason string) error {
-	_, err := m.quarColl.InsertOne(ctx, bson.M{
+func (m *RecordDB) InsertToQuarantine(ctx context.Context, data interface{}, userID string, recordType string, recordErr models.RecordError, provenance *models.Provenance) error {
+	doc := bson.M{
 		"data":       data,
 		"userID":     userID,
 		"recordType": recordType,
-		"reason":     reason,
+		"errorCode":  recordErr.Code,
+		"reason":     recordErr.Reason,
 		"timestamp":  time.Now(),
-	})
+	}
+	if recordErr.Field != "" {
+		doc["field"] = recordErr.Field
+	}
+	if provenance != nil {
+		doc["provenance"] = provenance
+	}
+	_, err := m.quarColl.InsertOne(ctx, doc)
 	return err
 }
 
@@ -96,34 +203,26 @@ func (m *RecordDB) GetAllValidData(ctx context.Context) ([]bson.M, error) {
 	return results, nil
 }
 
-// GetUserData fetches user-specific data, optionally filtered by date range.
-func (m *RecordDB) GetUserData(ctx context.Context, userID string, from, to *time.Time) ([]bson.M, error) {
+// GetUserData fetches user-specific data, optionally filtered by ingestion or event time.
+func (m *RecordDB) GetUserData(ctx context.Context, userID string, timeRange TimeRange) ([]bson.M, error) {
 	// Build the base filter for user ID
 	filter := bson.M{
 		"userID": userID,
 	}
 
-	// If you’re using a 'timestamp' field, add date range conditions
-	// only if 'from' or 'to' are provided
-	dateFilter := bson.M{}
-	if from != nil {
-		dateFilter["$gte"] = *from
-	}
-	if to != nil {
-		dateFilter["$lte"] = *to
-	}
-	if len(dateFilter) > 0 {
-		filter["timestamp"] = dateFilter
-	}
+	// Add date range conditions only if 'from' or 'to' are provided
+	timeRange.apply(filter)
 
 	// Create the aggregation pipeline
 	pipeline := mongo.Pipeline{
 		// Stage 1: Match the filter
 		{{Key: "$match", Value: filter}},
-		// Stage 2: Project fields to include recordType and data
+		// Stage 2: Project fields to include recordType, data and both times
 		{{Key: "$project", Value: bson.M{
 			"recordType": 1,
 			"data":       1,
+			"timestamp":  1,
+			"eventTime":  1,
 			"_id":        0,
 		}}},
 	}
@@ -213,12 +312,13 @@ func (m *RecordDB) GetFieldsForUserAndType(ctx context.Context, userID string, r
 	return results[0], nil
 }
 
-func (m *RecordDB) AggregateData(ctx context.Context, userID, recordType, field string) ([]float64, error) {
+func (m *RecordDB) AggregateData(ctx context.Context, userID, recordType, field string, timeRange TimeRange) ([]float64, error) {
 	// Build the base filter
 	filter := bson.M{
 		"userID":     userID,
 		"recordType": recordType,
 	}
+	timeRange.apply(filter)
 
 	// Fetch raw data from MongoDB
 	cursor, err := m.validColl.Find(ctx, filter)
@@ -253,3 +353,112 @@ func (m *RecordDB) AggregateData(ctx context.Context, userID, recordType, field
 
 	return values, nil
 }
+
+// RollbackResult summarises the records removed by RollbackBatch.
+type RollbackResult struct {
+	DeletedValid       int64 `json:"deletedValid"`
+	DeletedQuarantined int64 `json:"deletedQuarantined"`
+	// PrunedFields lists, per record type, the fields dropped from record_fields because
+	// no remaining record has them.
+	PrunedFields map[string][]string `json:"prunedFields"`
+}
+
+// RollbackBatch removes every valid and quarantined record stamped with the batch ID, then
+// prunes the record_fields of the affected record types.
+func (m *RecordDB) RollbackBatch(ctx context.Context, userID, batchID string) (*RollbackResult, error) {
+	filter := bson.M{
+		"userID":             userID,
+		"provenance.batchID": batchID,
+	}
+
+	recordTypes, err := m.batchRecordTypes(ctx, m.validColl, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	validRes, err := m.validColl.DeleteMany(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete records of batch %s: %w", batchID, err)
+	}
+	quarRes, err := m.quarColl.DeleteMany(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete quarantined records of batch %s: %w", batchID, err)
+	}
+
+	result := &RollbackResult{
+		DeletedValid:       validRes.DeletedCount,
+		DeletedQuarantined: quarRes.DeletedCount,
+		PrunedFields:       make(map[string][]string),
+	}
+	if err := m.pruneRecordTypes(ctx, userID, recordTypes, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// pruneRecordFields drops the fields of a record type that no valid record has any more and
+// returns them. A record type without records loses its record_fields entry.
+func (m *RecordDB) pruneRecordFields(ctx context.Context, userID, recordType string) ([]string, error) {
+	filter := bson.M{
+		"userID":     userID,
+		"recordType": recordType,
+	}
+
+	var current struct {
+		Fields []string `bson:"fields"`
+	}
+	err := m.recordFields.FindOne(ctx, filter).Decode(&current)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Step 1: Collect the fields still backed by data
+	cursor, err := m.validColl.Find(ctx, filter, options.Find().SetProjection(bson.M{"data": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	remaining := make(map[string]struct{})
+	records := 0
+	for cursor.Next(ctx) {
+		var doc struct {
+			Data interface{} `bson:"data"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		records++
+		for _, field := range utils.TraverseDynamicJSON(utils.FromBSON(doc.Data)) {
+			remaining[field] = struct{}{}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	// Step 2: Drop the rest. Only fields known before the scan are removed, so fields added
+	// by a concurrent upload are kept.
+	stale := []string{}
+	for _, field := range current.Fields {
+		if _, ok := remaining[field]; !ok {
+			stale = append(stale, field)
+		}
+	}
+	if records == 0 {
+		_, err = m.recordFields.DeleteOne(ctx, bson.M{
+			"userID":     userID,
+			"recordType": recordType,
+			"fields":     bson.M{"$not": bson.M{"$elemMatch": bson.M{"$nin": current.Fields}}},
+		})
+	} else if len(stale) > 0 {
+		_, err = m.recordFields.UpdateOne(ctx, filter, bson.M{"$pullAll": bson.M{"fields": stale}})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to prune fields for userID %s and recordType %s: %w", userID, recordType, err)
+	}
+	return stale, nil
+}
@@ -0,0 +1,87 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/vd09-projects/my-documentdb-system/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RecordTypeDB stores the per-record-type settings such as natural keys, transforms and event time.
+type RecordTypeDB struct {
+	coll *mongo.Collection
+}
+
+func NewRecordTypeDB(client *mongo.Client, dbName string) *RecordTypeDB {
+	return &RecordTypeDB{
+		coll: client.Database(dbName).Collection(RecordTypeConfigsCollection),
+	}
+}
+
+// GetConfig returns the settings of a record type, or nil if none were saved.
+func (d *RecordTypeDB) GetConfig(ctx context.Context, userID, recordType string) (*models.RecordTypeConfig, error) {
+	filter := bson.M{
+		"userID":     userID,
+		"recordType": recordType,
+	}
+	var config models.RecordTypeConfig
+	err := d.coll.FindOne(ctx, filter).Decode(&config)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// SetNaturalKey sets the natural key of a record type. An empty key removes it.
+func (d *RecordTypeDB) SetNaturalKey(ctx context.Context, userID, recordType string, fields []string) error {
+	update := bson.M{
+		"$set": bson.M{"updatedAt": time.Now()},
+	}
+	if len(fields) > 0 {
+		update["$set"].(bson.M)["naturalKey"] = fields
+	} else {
+		update["$unset"] = bson.M{"naturalKey": ""}
+	}
+	return d.updateConfig(ctx, userID, recordType, update)
+}
+
+// SetTransforms replaces the transform pipeline of a record type. No transforms removes it.
+func (d *RecordTypeDB) SetTransforms(ctx context.Context, userID, recordType string, transforms []models.Transform) error {
+	update := bson.M{
+		"$set": bson.M{"updatedAt": time.Now()},
+	}
+	if len(transforms) > 0 {
+		update["$set"].(bson.M)["transforms"] = transforms
+	} else {
+		update["$unset"] = bson.M{"transforms": ""}
+	}
+	return d.updateConfig(ctx, userID, recordType, update)
+}
+
+// SetEventTime sets the event time field of a record type. A nil eventTime removes it.
+func (d *RecordTypeDB) SetEventTime(ctx context.Context, userID, recordType string, eventTime *models.EventTime) error {
+	update := bson.M{
+		"$set": bson.M{"updatedAt": time.Now()},
+	}
+	if eventTime != nil {
+		update["$set"].(bson.M)["eventTime"] = eventTime
+	} else {
+		update["$unset"] = bson.M{"eventTime": ""}
+	}
+	return d.updateConfig(ctx, userID, recordType, update)
+}
+
+func (d *RecordTypeDB) updateConfig(ctx context.Context, userID, recordType string, update bson.M) error {
+	filter := bson.M{
+		"userID":     userID,
+		"recordType": recordType,
+	}
+	_, err := d.coll.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	return err
+}
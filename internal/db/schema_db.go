@@ -0,0 +1,213 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/vd09-projects/my-documentdb-system/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SchemaDB keeps every version of the schemas attached to record types.
+// The highest version of a record type is the one uploads are validated against.
+type SchemaDB struct {
+	coll      *mongo.Collection
+	validColl *mongo.Collection
+}
+
+func NewSchemaDB(client *mongo.Client, dbName string) *SchemaDB {
+	return &SchemaDB{
+		coll:      client.Database(dbName).Collection(RecordSchemasCollection),
+		validColl: client.Database(dbName).Collection(ValidCollection),
+	}
+}
+
+// SaveSchema stores schema as the next version of the record type and returns that version.
+func (s *SchemaDB) SaveSchema(ctx context.Context, userID, recordType, schema string) (int, error) {
+	return s.addVersion(ctx, models.RecordSchema{
+		UserID:     userID,
+		RecordType: recordType,
+		Schema:     schema,
+	})
+}
+
+// RemoveSchema detaches the schema of a record type by recording an empty version, so the
+// history is kept. It reports whether a schema was attached.
+func (s *SchemaDB) RemoveSchema(ctx context.Context, userID, recordType string) (bool, error) {
+	current, err := s.GetSchema(ctx, userID, recordType)
+	if err != nil || current == nil {
+		return false, err
+	}
+	_, err = s.addVersion(ctx, models.RecordSchema{
+		UserID:     userID,
+		RecordType: recordType,
+		Removed:    true,
+	})
+	return err == nil, err
+}
+
+func (s *SchemaDB) addVersion(ctx context.Context, schema models.RecordSchema) (int, error) {
+	// Retry when a concurrent save took the version first
+	for attempt := 0; attempt < 3; attempt++ {
+		latest, err := s.latestVersion(ctx, schema.UserID, schema.RecordType)
+		if err != nil {
+			return 0, err
+		}
+		schema.Version = latest + 1
+		schema.CreatedAt = time.Now()
+
+		_, err = s.coll.InsertOne(ctx, schema)
+		if mongo.IsDuplicateKeyError(err) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		return schema.Version, nil
+	}
+	return 0, fmt.Errorf("failed to save schema for recordType %s: concurrent updates", schema.RecordType)
+}
+
+func (s *SchemaDB) latestVersion(ctx context.Context, userID, recordType string) (int, error) {
+	latest, err := s.findLatest(ctx, userID, recordType)
+	if err != nil || latest == nil {
+		return 0, err
+	}
+	return latest.Version, nil
+}
+
+func (s *SchemaDB) findLatest(ctx context.Context, userID, recordType string) (*models.RecordSchema, error) {
+	filter := bson.M{
+		"userID":     userID,
+		"recordType": recordType,
+	}
+	opts := options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}})
+
+	var schema models.RecordSchema
+	err := s.coll.FindOne(ctx, filter, opts).Decode(&schema)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &schema, nil
+}
+
+// GetSchema returns the current schema of a record type, or nil if none is attached.
+func (s *SchemaDB) GetSchema(ctx context.Context, userID, recordType string) (*models.RecordSchema, error) {
+	latest, err := s.findLatest(ctx, userID, recordType)
+	if err != nil || latest == nil || latest.Removed {
+		return nil, err
+	}
+	return latest, nil
+}
+
+// GetSchemaVersion returns one version of a record type's schema, or nil if it does not exist.
+func (s *SchemaDB) GetSchemaVersion(ctx context.Context, userID, recordType string, version int) (*models.RecordSchema, error) {
+	filter := bson.M{
+		"userID":     userID,
+		"recordType": recordType,
+		"version":    version,
+	}
+	var schema models.RecordSchema
+	err := s.coll.FindOne(ctx, filter).Decode(&schema)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &schema, nil
+}
+
+// ListSchemaVersions returns the version history of a record type, oldest first.
+func (s *SchemaDB) ListSchemaVersions(ctx context.Context, userID, recordType string) ([]models.RecordSchema, error) {
+	filter := bson.M{
+		"userID":     userID,
+		"recordType": recordType,
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "version", Value: 1}})
+	cursor, err := s.coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	versions := []models.RecordSchema{}
+	if err := cursor.All(ctx, &versions); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// ListSchemas returns the current schema of every record type that has one, sorted by record type.
+func (s *SchemaDB) ListSchemas(ctx context.Context, userID string) ([]models.RecordSchema, error) {
+	pipeline := mongo.Pipeline{
+		// Stage 1: Match the user's schemas
+		{{Key: "$match", Value: bson.M{"userID": userID}}},
+		// Stage 2: Newest version first so $first picks the current one
+		{{Key: "$sort", Value: bson.D{{Key: "recordType", Value: 1}, {Key: "version", Value: -1}}}},
+		// Stage 3: Keep the current version of each record type
+		{{Key: "$group", Value: bson.M{
+			"_id":    "$recordType",
+			"latest": bson.M{"$first": "$$ROOT"},
+		}}},
+		{{Key: "$replaceRoot", Value: bson.M{"newRoot": "$latest"}}},
+		// Stage 4: Drop record types whose schema was detached
+		{{Key: "$match", Value: bson.M{"removed": bson.M{"$ne": true}}}},
+		{{Key: "$sort", Value: bson.M{"recordType": 1}}},
+	}
+
+	cursor, err := s.coll.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	schemas := []models.RecordSchema{}
+	if err := cursor.All(ctx, &schemas); err != nil {
+		return nil, err
+	}
+	return schemas, nil
+}
+
+// CountRecordsBySchemaVersion counts the valid records of a record type per schema version.
+// Records stored before any schema was attached are counted under version 0.
+func (s *SchemaDB) CountRecordsBySchemaVersion(ctx context.Context, userID, recordType string) (map[int]int64, error) {
+	pipeline := mongo.Pipeline{
+		// Stage 1: Match the record type
+		{{Key: "$match", Value: bson.M{
+			"userID":     userID,
+			"recordType": recordType,
+		}}},
+		// Stage 2: Count per stamped version
+		{{Key: "$group", Value: bson.M{
+			"_id":   bson.M{"$ifNull": bson.A{"$schemaVersion", 0}},
+			"count": bson.M{"$sum": 1},
+		}}},
+	}
+
+	cursor, err := s.validColl.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var results []struct {
+		Version int   `bson:"_id"`
+		Count   int64 `bson:"count"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[int]int64, len(results))
+	for _, res := range results {
+		counts[res.Version] = res.Count
+	}
+	return counts, nil
+}
@@ -0,0 +1,237 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// stagedChunkSize is the number of staged documents written per bulk write of a publish.
+const stagedChunkSize = 500
+
+// MaxPublishRecords is the largest number of records, staged and replaced together, that
+// PublishStagedBatch switches in its single transaction. It keeps a publish well inside
+// MongoDB's transaction time and size limits.
+var MaxPublishRecords int64 = 10000
+
+// ErrBatchTooLarge is returned by PublishStagedBatch for a batch over MaxPublishRecords.
+var ErrBatchTooLarge = errors.New("batch is too large to publish in one transaction")
+
+// PublishStagedBatch moves the records staged under batchID into valid_records and
+// quarantine_records and deletes every record of replacesBatchID, all in one transaction, so
+// readers see either the old batch or the new one. Staged records with a natural key replace
+// the live record with that key. commit runs inside the same transaction, e.g. to record the
+// replacement on the uploads. Batches over MaxPublishRecords are refused with ErrBatchTooLarge
+// and stay staged. Transactions need MongoDB to run as a replica set.
+//
+// The fields of the old batch's record types are pruned after the switch. The result is
+// non-nil once the records are switched, even if pruning then fails.
+func (m *RecordDB) PublishStagedBatch(ctx context.Context, userID, batchID, replacesBatchID string, commit func(ctx context.Context) error) (*RollbackResult, error) {
+	database := m.client.Database(m.dbName)
+	stagingValid := database.Collection(StagingValidCollection)
+	stagingQuar := database.Collection(StagingQuarantineCollection)
+
+	newFilter := bson.M{"userID": userID, "provenance.batchID": batchID}
+	oldFilter := bson.M{"userID": userID, "provenance.batchID": replacesBatchID}
+
+	var total int64
+	for _, c := range []struct {
+		coll   *mongo.Collection
+		filter bson.M
+	}{{stagingValid, newFilter}, {stagingQuar, newFilter}, {m.validColl, oldFilter}, {m.quarColl, oldFilter}} {
+		count, err := c.coll.CountDocuments(ctx, c.filter)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count records of batch %s: %w", batchID, err)
+		}
+		total += count
+	}
+	if total > MaxPublishRecords {
+		return nil, fmt.Errorf("%w: %d records to switch, at most %d", ErrBatchTooLarge, total, MaxPublishRecords)
+	}
+
+	// The old batch's record types may lose fields
+	recordTypes, err := m.batchRecordTypes(ctx, m.validColl, oldFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := m.client.StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+
+	result := &RollbackResult{PrunedFields: make(map[string][]string)}
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		if err := moveStaged(sc, stagingValid, m.validColl, newFilter, true); err != nil {
+			return nil, err
+		}
+		if err := moveStaged(sc, stagingQuar, m.quarColl, newFilter, false); err != nil {
+			return nil, err
+		}
+		// Replaced records are matched by batch, so records the move just upserted are kept
+		deletedValid, err := m.validColl.DeleteMany(sc, oldFilter)
+		if err != nil {
+			return nil, err
+		}
+		deletedQuarantined, err := m.quarColl.DeleteMany(sc, oldFilter)
+		if err != nil {
+			return nil, err
+		}
+		if commit != nil {
+			if err := commit(sc); err != nil {
+				return nil, err
+			}
+		}
+		result.DeletedValid = deletedValid.DeletedCount
+		result.DeletedQuarantined = deletedQuarantined.DeletedCount
+		return nil, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to publish batch %s: %w", batchID, err)
+	}
+
+	if err := m.pruneRecordTypes(ctx, userID, recordTypes, result); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// DiscardStagedBatch deletes the records staged under batchID and prunes the fields they added.
+func (m *RecordDB) DiscardStagedBatch(ctx context.Context, userID, batchID string) error {
+	database := m.client.Database(m.dbName)
+	stagingValid := database.Collection(StagingValidCollection)
+	filter := bson.M{"userID": userID, "provenance.batchID": batchID}
+
+	recordTypes, err := m.batchRecordTypes(ctx, stagingValid, filter)
+	if err != nil {
+		return err
+	}
+	if _, err := stagingValid.DeleteMany(ctx, filter); err != nil {
+		return fmt.Errorf("failed to discard batch %s: %w", batchID, err)
+	}
+	if _, err := database.Collection(StagingQuarantineCollection).DeleteMany(ctx, filter); err != nil {
+		return fmt.Errorf("failed to discard batch %s: %w", batchID, err)
+	}
+	return m.pruneRecordTypes(ctx, userID, recordTypes, &RollbackResult{PrunedFields: make(map[string][]string)})
+}
+
+// StagedBatch identifies a batch with records in staging.
+type StagedBatch struct {
+	UserID  string
+	BatchID string
+}
+
+// StagedBatches lists the batches with records in either staging collection.
+func (m *RecordDB) StagedBatches(ctx context.Context) ([]StagedBatch, error) {
+	database := m.client.Database(m.dbName)
+	seen := make(map[StagedBatch]struct{})
+	batches := []StagedBatch{}
+	for _, name := range []string{StagingValidCollection, StagingQuarantineCollection} {
+		pipeline := mongo.Pipeline{
+			{{Key: "$group", Value: bson.M{"_id": bson.M{"userID": "$userID", "batchID": "$provenance.batchID"}}}},
+		}
+		cursor, err := database.Collection(name).Aggregate(ctx, pipeline)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list staged batches: %w", err)
+		}
+		var groups []struct {
+			ID struct {
+				UserID  string `bson:"userID"`
+				BatchID string `bson:"batchID"`
+			} `bson:"_id"`
+		}
+		if err := cursor.All(ctx, &groups); err != nil {
+			return nil, fmt.Errorf("failed to list staged batches: %w", err)
+		}
+		for _, group := range groups {
+			batch := StagedBatch{UserID: group.ID.UserID, BatchID: group.ID.BatchID}
+			if _, ok := seen[batch]; !ok {
+				seen[batch] = struct{}{}
+				batches = append(batches, batch)
+			}
+		}
+	}
+	return batches, nil
+}
+
+// moveStaged moves the staged documents matching filter into the live collection within the
+// transaction of sc, writing them a chunk at a time.
+func moveStaged(sc mongo.SessionContext, from, to *mongo.Collection, filter bson.M, valid bool) error {
+	cursor, err := from.Find(sc, filter)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(sc)
+
+	writes := make([]mongo.WriteModel, 0, stagedChunkSize)
+	flush := func() error {
+		if len(writes) == 0 {
+			return nil
+		}
+		_, err := to.BulkWrite(sc, writes)
+		writes = writes[:0]
+		return err
+	}
+	for cursor.Next(sc) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		if key, ok := doc["naturalKey"].(string); valid && ok {
+			// The live record keeps its _id, which cannot be changed by a replacement
+			delete(doc, "_id")
+			filter := bson.M{
+				"userID":     doc["userID"],
+				"recordType": doc["recordType"],
+				"naturalKey": key,
+			}
+			writes = append(writes, mongo.NewReplaceOneModel().SetFilter(filter).SetReplacement(doc).SetUpsert(true))
+		} else {
+			writes = append(writes, mongo.NewInsertOneModel().SetDocument(doc))
+		}
+		if len(writes) == stagedChunkSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	_, err = from.DeleteMany(sc, filter)
+	return err
+}
+
+func (m *RecordDB) batchRecordTypes(ctx context.Context, coll *mongo.Collection, filter bson.M) ([]string, error) {
+	values, err := coll.Distinct(ctx, "recordType", filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find record types of batch: %w", err)
+	}
+	recordTypes := make([]string, 0, len(values))
+	for _, value := range values {
+		if recordType, ok := value.(string); ok {
+			recordTypes = append(recordTypes, recordType)
+		}
+	}
+	return recordTypes, nil
+}
+
+func (m *RecordDB) pruneRecordTypes(ctx context.Context, userID string, recordTypes []string, result *RollbackResult) error {
+	for _, recordType := range recordTypes {
+		pruned, err := m.pruneRecordFields(ctx, userID, recordType)
+		if err != nil {
+			return err
+		}
+		if len(pruned) > 0 {
+			result.PrunedFields[recordType] = pruned
+		}
+	}
+	return nil
+}
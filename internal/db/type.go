@@ -4,16 +4,65 @@ import (
 	"context"
 	"time"
 
+	"github.com/vd09-projects/my-documentdb-system/internal/models"
 	"go.mongodb.org/mongo-driver/bson"
 )
 
+// ValidRecord is a record that passed validation, plus the metadata stored next to it.
+type ValidRecord struct {
+	Data interface{}
+	// SchemaVersion is the schema version the record was validated against; 0 when its record type had no schema.
+	SchemaVersion int
+	// NaturalKey identifies the record within its record type. A keyed record replaces the
+	// stored record with the same key instead of being added next to it.
+	NaturalKey string
+	// Provenance, when set, links the record to the upload that stored it.
+	Provenance *models.Provenance
+	// EventTime is when the record's event happened, read from the field its record type names.
+	// It is stored next to the ingestion timestamp.
+	EventTime *time.Time
+}
+
+// Time fields records can be filtered on.
+const (
+	TimeFieldIngestion = "timestamp"
+	TimeFieldEvent     = "eventTime"
+)
+
+// TimeRange restricts a query to records whose ingestion or event time lies between From and To.
+// Either bound may be nil. Records without an event time never match an event time range.
+type TimeRange struct {
+	Field    string
+	From, To *time.Time
+}
+
+// apply adds the range to a filter on valid records.
+func (t TimeRange) apply(filter bson.M) {
+	dateFilter := bson.M{}
+	if t.From != nil {
+		dateFilter["$gte"] = *t.From
+	}
+	if t.To != nil {
+		dateFilter["$lte"] = *t.To
+	}
+	if len(dateFilter) == 0 {
+		return
+	}
+	field := t.Field
+	if field == "" {
+		field = TimeFieldIngestion
+	}
+	filter[field] = dateFilter
+}
+
 type Database interface {
-	InsertToValid(ctx context.Context, data interface{}, userID string, recordType string) error
+	InsertToValid(ctx context.Context, record ValidRecord, userID string, recordType string) error
+	InsertManyToValid(ctx context.Context, records []ValidRecord, userID string, recordType string) error
 	InsertToRecordFields(ctx context.Context, data interface{}, userID string, recordType string) error
-	InsertToQuarantine(ctx context.Context, data interface{}, userID string, recordType string, reason string) error
+	InsertToQuarantine(ctx context.Context, data interface{}, userID string, recordType string, recordErr models.RecordError, provenance *models.Provenance) error
 	GetAllValidData(ctx context.Context) ([]bson.M, error)
-	GetUserData(ctx context.Context, userID string, from, to *time.Time) ([]bson.M, error)
+	GetUserData(ctx context.Context, userID string, timeRange TimeRange) ([]bson.M, error)
 	GetRecordTypesForUser(ctx context.Context, userID string) ([]bson.M, error)
 	GetFieldsForUserAndType(ctx context.Context, userID string, recordType string) (bson.M, error)
-	AggregateData(ctx context.Context, userID, recordType, field string) ([]float64, error)
+	AggregateData(ctx context.Context, userID, recordType, field string, timeRange TimeRange) ([]float64, error)
 }
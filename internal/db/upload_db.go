@@ -0,0 +1,182 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/vd09-projects/my-documentdb-system/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// UploadStatusRolledBack is the status of an upload whose records were removed. The other
+// statuses are those of the job that processed the upload.
+const UploadStatusRolledBack = "rolledBack"
+
+// UploadStatusReplaced is the status of an upload whose records a re-ingestion replaced.
+const UploadStatusReplaced = "replaced"
+
+// UploadDB keeps a record of every upload so that repeats can be detected and batches rolled back.
+type UploadDB struct {
+	coll *mongo.Collection
+}
+
+func NewUploadDB(client *mongo.Client, dbName string) *UploadDB {
+	return &UploadDB{
+		coll: client.Database(dbName).Collection(UploadsCollection),
+	}
+}
+
+// CreateUpload stores a new upload. If an upload with the same dedupe key already exists,
+// nothing is stored and that upload is returned instead.
+func (d *UploadDB) CreateUpload(ctx context.Context, upload models.Upload) (*models.Upload, error) {
+	_, err := d.coll.InsertOne(ctx, upload)
+	if err == nil || !mongo.IsDuplicateKeyError(err) || upload.DedupeKey == "" {
+		return nil, err
+	}
+
+	var existing models.Upload
+	filter := bson.M{
+		"userID":    upload.UserID,
+		"dedupeKey": upload.DedupeKey,
+	}
+	if err := d.coll.FindOne(ctx, filter).Decode(&existing); err != nil {
+		return nil, err
+	}
+	return &existing, nil
+}
+
+// FinishUpload records the outcome of an upload. Uploads that did not complete lose their
+// dedupe key so the same file can be uploaded again.
+func (d *UploadDB) FinishUpload(ctx context.Context, id, status string, inserted, quarantined int64, completed bool) error {
+	update := bson.M{
+		"$set": bson.M{
+			"status":      status,
+			"inserted":    inserted,
+			"quarantined": quarantined,
+			"finishedAt":  time.Now(),
+		},
+	}
+	if !completed {
+		update["$unset"] = bson.M{"dedupeKey": ""}
+	}
+	// A batch rolled back or replaced as its job wound down keeps that status
+	filter := bson.M{"_id": id, "status": bson.M{"$nin": bson.A{UploadStatusRolledBack, UploadStatusReplaced}}}
+	_, err := d.coll.UpdateOne(ctx, filter, update)
+	return err
+}
+
+// DeleteUpload removes the record of an upload that never ran.
+func (d *UploadDB) DeleteUpload(ctx context.Context, id string) error {
+	_, err := d.coll.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+// GetUpload returns one upload of the user, or nil if there is none with that ID.
+func (d *UploadDB) GetUpload(ctx context.Context, userID, id string) (*models.Upload, error) {
+	var upload models.Upload
+	err := d.coll.FindOne(ctx, bson.M{"_id": id, "userID": userID}).Decode(&upload)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+// ListUploads returns a page of the user's uploads, newest first, and the total number of uploads.
+func (d *UploadDB) ListUploads(ctx context.Context, userID string, limit, offset int64) ([]models.Upload, int64, error) {
+	filter := bson.M{"userID": userID}
+	total, err := d.coll.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(offset).
+		SetLimit(limit)
+	cursor, err := d.coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	uploads := []models.Upload{}
+	if err := cursor.All(ctx, &uploads); err != nil {
+		return nil, 0, err
+	}
+	return uploads, total, nil
+}
+
+// MarkRolledBack records that the records of an upload were removed. The dedupe key is
+// cleared so the same file can be uploaded again.
+func (d *UploadDB) MarkRolledBack(ctx context.Context, userID, id string) error {
+	_, err := d.coll.UpdateOne(ctx,
+		bson.M{"_id": id, "userID": userID},
+		bson.M{
+			"$set":   bson.M{"status": UploadStatusRolledBack, "rolledBackAt": time.Now()},
+			"$unset": bson.M{"dedupeKey": ""},
+		},
+	)
+	return err
+}
+
+// ClaimReplacement reserves an upload for the re-ingestion replacingBy, so that only one
+// re-ingestion of it runs at a time. A claim left by a re-ingestion that is no longer running
+// is taken over by passing its ID as stale. It reports false if the upload was replaced or
+// claimed by another re-ingestion.
+func (d *UploadDB) ClaimReplacement(ctx context.Context, userID, id, stale, replacingBy string) (bool, error) {
+	filter := bson.M{
+		"_id":         id,
+		"userID":      userID,
+		"status":      bson.M{"$ne": UploadStatusReplaced},
+		"replacingBy": bson.M{"$exists": false},
+	}
+	if stale != "" {
+		filter["replacingBy"] = stale
+	}
+	res, err := d.coll.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"replacingBy": replacingBy}})
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// ReleaseReplacement drops the claim of a re-ingestion that did not replace the upload.
+func (d *UploadDB) ReleaseReplacement(ctx context.Context, userID, id, replacingBy string) error {
+	_, err := d.coll.UpdateOne(ctx,
+		bson.M{"_id": id, "userID": userID, "replacingBy": replacingBy},
+		bson.M{"$unset": bson.M{"replacingBy": ""}},
+	)
+	return err
+}
+
+// ListReplacementClaims returns the uploads claimed by a re-ingestion that has not finished.
+func (d *UploadDB) ListReplacementClaims(ctx context.Context) ([]models.Upload, error) {
+	cursor, err := d.coll.Find(ctx, bson.M{"replacingBy": bson.M{"$exists": true}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	uploads := []models.Upload{}
+	if err := cursor.All(ctx, &uploads); err != nil {
+		return nil, err
+	}
+	return uploads, nil
+}
+
+// MarkReplaced records that a re-ingested upload replaced the records of an earlier one.
+func (d *UploadDB) MarkReplaced(ctx context.Context, userID, id, replacedBy string) error {
+	_, err := d.coll.UpdateOne(ctx,
+		bson.M{"_id": id, "userID": userID},
+		bson.M{
+			"$set":   bson.M{"status": UploadStatusReplaced, "replacedBy": replacedBy},
+			"$unset": bson.M{"dedupeKey": "", "replacingBy": ""},
+		},
+	)
+	return err
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/vd09-projects/my-documentdb-system/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// UploadSessionDB tracks resumable uploads while their chunks arrive.
+type UploadSessionDB struct {
+	coll *mongo.Collection
+}
+
+func NewUploadSessionDB(client *mongo.Client, dbName string) *UploadSessionDB {
+	return &UploadSessionDB{
+		coll: client.Database(dbName).Collection(UploadSessionsCollection),
+	}
+}
+
+func (d *UploadSessionDB) CreateSession(ctx context.Context, session models.UploadSession) error {
+	_, err := d.coll.InsertOne(ctx, session)
+	return err
+}
+
+// GetSession returns one of the user's upload sessions, or nil if there is none with that ID.
+func (d *UploadSessionDB) GetSession(ctx context.Context, userID string, id primitive.ObjectID) (*models.UploadSession, error) {
+	var session models.UploadSession
+	err := d.coll.FindOne(ctx, bson.M{"_id": id, "userID": userID}).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// AdvanceSession records that the bytes up to offset have been stored, provided the session
+// is still at from. It reports false if another request moved the session first.
+func (d *UploadSessionDB) AdvanceSession(ctx context.Context, id primitive.ObjectID, from, offset int64, hashState []byte, expiresAt time.Time) (bool, error) {
+	res, err := d.coll.UpdateOne(ctx,
+		bson.M{"_id": id, "offset": from},
+		bson.M{"$set": bson.M{"offset": offset, "hashState": hashState, "expiresAt": expiresAt}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return res.MatchedCount > 0, nil
+}
+
+// CompleteSession links a session whose file is complete to the upload that ingests it.
+func (d *UploadSessionDB) CompleteSession(ctx context.Context, id primitive.ObjectID, uploadID string) error {
+	_, err := d.coll.UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{"uploadID": uploadID}},
+	)
+	return err
+}
+
+// DeleteSession removes a session record. It reports whether the session existed.
+func (d *UploadSessionDB) DeleteSession(ctx context.Context, userID string, id primitive.ObjectID) (bool, error) {
+	res, err := d.coll.DeleteOne(ctx, bson.M{"_id": id, "userID": userID})
+	if err != nil {
+		return false, err
+	}
+	return res.DeletedCount > 0, nil
+}
+
+// ListExpiredSessions returns the sessions whose expiry time has passed.
+func (d *UploadSessionDB) ListExpiredSessions(ctx context.Context, now time.Time) ([]models.UploadSession, error) {
+	cursor, err := d.coll.Find(ctx, bson.M{"expiresAt": bson.M{"$lt": now}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	sessions := []models.UploadSession{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
@@ -66,6 +66,7 @@ func ListFieldsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // e.g. GET /aggregate?recordType=sales&field=price&op=sum
+// from, to and timeField restrict it to a time range as for GET /userData.
 func AggregateHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -86,9 +87,15 @@ func AggregateHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	timeRange, err := parseTimeRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Use the RecordDB interface for database logic
 	metadataDB := db.NewRecordDB(db.MongoClient, db.DatabaseName)
-	result, err := metadataDB.AggregateData(ctx, userID, recordType, field)
+	result, err := metadataDB.AggregateData(ctx, userID, recordType, field, timeRange)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
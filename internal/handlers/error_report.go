@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vd09-projects/my-documentdb-system/internal/db"
+	"github.com/vd09-projects/my-documentdb-system/internal/models"
+	"github.com/vd09-projects/my-documentdb-system/internal/utils"
+)
+
+// errorReportRow is one quarantined record of an upload's error report.
+type errorReportRow struct {
+	Entry      string      `json:"entry,omitempty"`
+	Row        int         `json:"row"`
+	ID         string      `json:"id"`
+	RecordType string      `json:"recordType"`
+	Code       string      `json:"code"`
+	Field      string      `json:"field,omitempty"`
+	Reason     string      `json:"reason"`
+	Raw        interface{} `json:"raw"`
+}
+
+var errorReportColumns = []string{"entry", "row", "id", "recordType", "code", "field", "reason", "raw"}
+
+// e.g. GET /uploads/{id}/errors?format=csv
+// Lists the records of an upload that are still quarantined, in row order, with the error code,
+// the field at fault and the raw content as received; records of a ZIP upload also name their
+// archive entry. format is json (the default) or csv; in CSV reports the raw content of a CSV
+// row is written as one CSV line.
+func UploadErrorReportHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	claims, ok := r.Context().Value(UserClaimsKey).(*utils.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" {
+		http.Error(w, "Invalid format. Use json or csv", http.StatusBadRequest)
+		return
+	}
+
+	id := r.PathValue("id")
+	uploadDB := db.NewUploadDB(db.MongoClient, db.DatabaseName)
+	upload, err := uploadDB.GetUpload(ctx, claims.UserID, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if upload == nil {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return
+	}
+
+	fileName := fmt.Sprintf("upload-%s-errors.%s", id, format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+
+	quarantineDB := db.NewQuarantineDB(db.MongoClient, db.DatabaseName)
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		writer := csv.NewWriter(w)
+		writer.Write(errorReportColumns)
+		err = quarantineDB.EachBatchQuarantine(ctx, claims.UserID, id, func(record models.QuarantineRecord) error {
+			row := newErrorReportRow(record)
+			return writer.Write([]string{
+				row.Entry, strconv.Itoa(row.Row), row.ID, row.RecordType, row.Code, row.Field, row.Reason, rawContent(row.Raw),
+			})
+		})
+		writer.Flush()
+	} else {
+		// Stream the array so large reports are not held in memory
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("["))
+		encoder := json.NewEncoder(w)
+		first := true
+		err = quarantineDB.EachBatchQuarantine(ctx, claims.UserID, id, func(record models.QuarantineRecord) error {
+			if !first {
+				w.Write([]byte(","))
+			}
+			first = false
+			return encoder.Encode(newErrorReportRow(record))
+		})
+		w.Write([]byte("]\n"))
+	}
+	// The status line has been sent, so a failure can only cut the report short
+	if err != nil {
+		log.Printf("Failed to write error report for upload %s: %v", id, err)
+	}
+}
+
+func newErrorReportRow(record models.QuarantineRecord) errorReportRow {
+	row := errorReportRow{
+		ID:         record.ID.Hex(),
+		RecordType: record.RecordType,
+		Code:       record.Code,
+		Field:      record.Field,
+		Reason:     record.Reason,
+		Raw:        record.Data,
+	}
+	if record.Provenance != nil {
+		row.Entry = record.Provenance.Entry
+		row.Row = record.Provenance.Row
+	}
+	return row
+}
+
+// rawContent renders a quarantined record's data as one text cell: CSV and XLSX rows as a CSV
+// line, text such as a JSON line as it is, and anything else as JSON.
+func rawContent(data interface{}) string {
+	switch v := data.(type) {
+	case string:
+		return v
+	case []interface{}:
+		cells := make([]string, len(v))
+		for i, cell := range v {
+			text, ok := cell.(string)
+			if !ok {
+				return rawJSON(data)
+			}
+			cells[i] = text
+		}
+		var buf bytes.Buffer
+		writer := csv.NewWriter(&buf)
+		writer.Write(cells)
+		writer.Flush()
+		return strings.TrimSuffix(buf.String(), "\n")
+	}
+	return rawJSON(data)
+}
+
+func rawJSON(data interface{}) string {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Sprint(data)
+	}
+	return string(raw)
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -22,34 +23,15 @@ func GetUserDataHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	userID := claims.UserID
 
-	// Optional date parsing
-	fromStr := r.URL.Query().Get("from")
-	toStr := r.URL.Query().Get("to")
-
-	var fromTime, toTime *time.Time
-	var err error
-
-	if fromStr != "" {
-		t, err := time.Parse("2006-01-02", fromStr)
-		if err != nil {
-			http.Error(w, "Invalid 'from' date format. Use YYYY-MM-DD", http.StatusBadRequest)
-			return
-		}
-		fromTime = &t
-	}
-
-	if toStr != "" {
-		t, err := time.Parse("2006-01-02", toStr)
-		if err != nil {
-			http.Error(w, "Invalid 'to' date format. Use YYYY-MM-DD", http.StatusBadRequest)
-			return
-		}
-		toTime = &t
+	timeRange, err := parseTimeRange(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	// Query the DB
 	database := db.NewRecordDB(db.MongoClient, db.DatabaseName)
-	results, err := database.GetUserData(ctx, userID, fromTime, toTime)
+	results, err := database.GetUserData(ctx, userID, timeRange)
 	if err != nil {
 		http.Error(w, "Failed to query data", http.StatusInternalServerError)
 		return
@@ -82,3 +64,37 @@ func GetAllDataHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(resp)
 }
+
+// parseTimeRange reads the optional from, to and timeField query parameters, e.g.
+// ?from=2024-01-01&to=2024-01-31&timeField=event. Dates are YYYY-MM-DD or RFC 3339 times.
+// timeField is "ingestion" (the default) for when records were stored, or "event" for the
+// event time read from the field their record type names.
+func parseTimeRange(r *http.Request) (db.TimeRange, error) {
+	var timeRange db.TimeRange
+	switch r.URL.Query().Get("timeField") {
+	case "", "ingestion":
+		timeRange.Field = db.TimeFieldIngestion
+	case "event":
+		timeRange.Field = db.TimeFieldEvent
+	default:
+		return timeRange, fmt.Errorf("Invalid 'timeField'. Use ingestion or event")
+	}
+
+	for _, bound := range []struct {
+		name string
+		dest **time.Time
+	}{{"from", &timeRange.From}, {"to", &timeRange.To}} {
+		value := r.URL.Query().Get(bound.name)
+		if value == "" {
+			continue
+		}
+		t, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			if t, err = time.Parse(time.RFC3339, value); err != nil {
+				return timeRange, fmt.Errorf("Invalid '%s' date format. Use YYYY-MM-DD or RFC 3339", bound.name)
+			}
+		}
+		*bound.dest = &t
+	}
+	return timeRange, nil
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/vd09-projects/my-documentdb-system/internal/db"
+	"github.com/vd09-projects/my-documentdb-system/internal/parsers"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Dry runs show defaultPreviewRows parsed records unless previewRows asks for up to maxPreviewRows.
+const (
+	defaultPreviewRows = 10
+	maxPreviewRows     = 100
+)
+
+// uploadPreview is the response to a dry run upload.
+type uploadPreview struct {
+	DryRun     bool   `json:"dryRun"`
+	RecordType string `json:"recordType"`
+	FileName   string `json:"fileName"`
+	// Valid and Quarantined count the records the upload would store in each collection
+	Valid       int                     `json:"valid"`
+	Quarantined int                     `json:"quarantined"`
+	Errors      []parsers.RowError      `json:"errors"`
+	Fields      []string                `json:"fields"`
+	Records     []parsers.PreviewRecord `json:"records"`
+}
+
+// previewUpload answers POST /upload?dryRun=true: it parses and validates the file like an
+// upload would, but stores nothing, not even the file. The response lists the first
+// previewRows valid records, every row that would be quarantined and why, and the field
+// paths the upload would add to record_fields.
+func previewUpload(w http.ResponseWriter, r *http.Request, file io.Reader, fileName string, format parsers.Format, opts parsers.ParseOptions) {
+	limit := defaultPreviewRows
+	if value := r.FormValue("previewRows"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || n > maxPreviewRows {
+			http.Error(w, "previewRows must be a number between 0 and "+strconv.Itoa(maxPreviewRows), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	database := parsers.NewPreviewDatabase(db.NewRecordDB(db.MongoClient, db.DatabaseName), limit)
+	parser := format.New(database)
+
+	// The batch ID is never stored; it only makes the parser stamp rows on the records
+	opts.BatchID = primitive.NewObjectID().Hex()
+	opts.FileName = fileName
+
+	ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
+	defer cancel()
+	result, err := parser.Parse(ctx, file, opts)
+	if err != nil {
+		if isUploadTooLarge(w, err) {
+			return
+		}
+		http.Error(w, "Failed to parse file: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(uploadPreview{
+		DryRun:      true,
+		RecordType:  opts.RecordType,
+		FileName:    fileName,
+		Valid:       result.Inserted,
+		Quarantined: result.Quarantined,
+		Errors:      result.Errors,
+		Fields:      result.Fields,
+		Records:     database.Records(),
+	})
+}
@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/vd09-projects/my-documentdb-system/internal/db"
+	"github.com/vd09-projects/my-documentdb-system/internal/models"
+	"github.com/vd09-projects/my-documentdb-system/internal/parsers"
+	"github.com/vd09-projects/my-documentdb-system/internal/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxQuarantineEditSize bounds the body of a quarantine edit.
+const maxQuarantineEditSize = 1 << 20 // 1MB
+
+type quarantineResponse struct {
+	ID         string             `json:"id"`
+	RecordType string             `json:"recordType"`
+	Code       string             `json:"code"`
+	Field      string             `json:"field,omitempty"`
+	Reason     string             `json:"reason"`
+	Data       interface{}        `json:"data"`
+	Timestamp  time.Time          `json:"timestamp"`
+	Provenance *models.Provenance `json:"provenance,omitempty"`
+}
+
+func newQuarantineResponse(record models.QuarantineRecord) quarantineResponse {
+	return quarantineResponse{
+		ID:         record.ID.Hex(),
+		RecordType: record.RecordType,
+		Code:       record.Code,
+		Field:      record.Field,
+		Reason:     record.Reason,
+		Data:       record.Data,
+		Timestamp:  record.Timestamp,
+		Provenance: record.Provenance,
+	}
+}
+
+// e.g. GET /quarantine?recordType=orders&reason=userId&code=SCHEMA_VIOLATION&from=2024-01-01&to=2024-01-31&limit=50&offset=0
+func ListQuarantineHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	claims, ok := r.Context().Value(UserClaimsKey).(*utils.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := db.QuarantineFilter{
+		RecordType: query.Get("recordType"),
+		Reason:     query.Get("reason"),
+		Code:       query.Get("code"),
+	}
+	if fromStr := query.Get("from"); fromStr != "" {
+		t, err := time.Parse("2006-01-02", fromStr)
+		if err != nil {
+			http.Error(w, "Invalid 'from' date format. Use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		filter.From = &t
+	}
+	if toStr := query.Get("to"); toStr != "" {
+		t, err := time.Parse("2006-01-02", toStr)
+		if err != nil {
+			http.Error(w, "Invalid 'to' date format. Use YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		filter.To = &t
+	}
+
+	limit, offset, err := parsePage(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	quarantineDB := db.NewQuarantineDB(db.MongoClient, db.DatabaseName)
+	records, total, err := quarantineDB.ListQuarantine(ctx, claims.UserID, filter, limit, offset)
+	if err != nil {
+		http.Error(w, "Failed to query quarantine", http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]quarantineResponse, 0, len(records))
+	for _, record := range records {
+		resp = append(resp, newQuarantineResponse(record))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"total":   total,
+		"records": resp,
+	})
+}
+
+// e.g. GET /quarantine/{id}
+func GetQuarantineHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	claims, ok := r.Context().Value(UserClaimsKey).(*utils.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Quarantined record not found", http.StatusNotFound)
+		return
+	}
+
+	quarantineDB := db.NewQuarantineDB(db.MongoClient, db.DatabaseName)
+	record, err := quarantineDB.GetQuarantine(ctx, claims.UserID, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if record == nil {
+		http.Error(w, "Quarantined record not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newQuarantineResponse(*record))
+}
+
+// e.g. PUT /quarantine/{id} with the corrected record as a JSON object
+// Replaces the stored data; the record stays quarantined until it is resubmitted.
+func UpdateQuarantineHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	claims, ok := r.Context().Value(UserClaimsKey).(*utils.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Quarantined record not found", http.StatusNotFound)
+		return
+	}
+
+	var data map[string]interface{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxQuarantineEditSize)).Decode(&data); err != nil || data == nil {
+		http.Error(w, "Body must be a JSON object", http.StatusBadRequest)
+		return
+	}
+
+	quarantineDB := db.NewQuarantineDB(db.MongoClient, db.DatabaseName)
+	found, err := quarantineDB.UpdateQuarantineData(ctx, claims.UserID, id, data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Quarantined record not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// e.g. POST /quarantine/{id}/resubmit
+// Validates the record the same way uploads are validated. A passing record moves to
+// valid_records; a failing one stays quarantined with the new reason and a 422 response.
+func ResubmitQuarantineHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	claims, ok := r.Context().Value(UserClaimsKey).(*utils.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Quarantined record not found", http.StatusNotFound)
+		return
+	}
+
+	quarantineDB := db.NewQuarantineDB(db.MongoClient, db.DatabaseName)
+	record, err := quarantineDB.GetQuarantine(ctx, claims.UserID, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if record == nil {
+		http.Error(w, "Quarantined record not found", http.StatusNotFound)
+		return
+	}
+
+	opts := parsers.ParseOptions{UserID: claims.UserID, RecordType: record.RecordType}
+	if err := loadValidationRules(ctx, &opts); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	valid, recordErr := revalidateQuarantined(*record, opts.Rules(record.RecordType))
+	if recordErr != nil {
+		if err := quarantineDB.UpdateQuarantineError(ctx, claims.UserID, id, *recordErr); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]string{
+			"status": "quarantined",
+			"code":   recordErr.Code,
+			"field":  recordErr.Field,
+			"reason": recordErr.Reason,
+		})
+		return
+	}
+
+	promoted, err := quarantineDB.PromoteQuarantine(ctx, *record, valid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !promoted {
+		http.Error(w, "Quarantined record not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"status": "promoted",
+	})
+}
+
+// e.g. DELETE /quarantine/{id}
+func DeleteQuarantineHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	claims, ok := r.Context().Value(UserClaimsKey).(*utils.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Quarantined record not found", http.StatusNotFound)
+		return
+	}
+
+	quarantineDB := db.NewQuarantineDB(db.MongoClient, db.DatabaseName)
+	deleted, err := quarantineDB.DeleteQuarantine(ctx, claims.UserID, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, "Quarantined record not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revalidateQuarantined runs a quarantined record through the upload transforms and validation.
+// Records whose data is not an object, such as a raw CSV row, have to be edited into one first.
+func revalidateQuarantined(record models.QuarantineRecord, rules parsers.RecordRules) (db.ValidRecord, *models.RecordError) {
+	data, isObject := utils.FromBSON(record.Data).(map[string]interface{})
+	if !isObject {
+		return db.ValidRecord{}, models.NewRecordError(models.ErrorNotObject, "",
+			"Data is not a JSON object; edit the record before resubmitting")
+	}
+	valid, recordErr := rules.Check(data)
+	if recordErr != nil {
+		return db.ValidRecord{}, recordErr
+	}
+	valid.Provenance = record.Provenance
+	return valid, nil
+}
@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/vd09-projects/my-documentdb-system/internal/db"
+	"github.com/vd09-projects/my-documentdb-system/internal/models"
+	"github.com/vd09-projects/my-documentdb-system/internal/parsers"
+	"github.com/vd09-projects/my-documentdb-system/internal/utils"
+)
+
+// maxNaturalKeyFields bounds the number of fields in a natural key.
+const maxNaturalKeyFields = 10
+
+// maxTransforms bounds the number of transforms of a record type.
+const maxTransforms = 100
+
+type naturalKeyRequest struct {
+	Fields []string `json:"fields"`
+}
+
+type transformsRequest struct {
+	Transforms []models.Transform `json:"transforms"`
+}
+
+// e.g. GET /recordTypes/{recordType}/naturalKey
+func GetNaturalKeyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	claims, ok := r.Context().Value(UserClaimsKey).(*utils.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	recordTypeDB := db.NewRecordTypeDB(db.MongoClient, db.DatabaseName)
+	config, err := recordTypeDB.GetConfig(ctx, claims.UserID, r.PathValue("recordType"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if config == nil || len(config.NaturalKey) == 0 {
+		http.Error(w, "No natural key for this record type", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(naturalKeyRequest{Fields: config.NaturalKey})
+}
+
+// e.g. PUT /recordTypes/{recordType}/naturalKey with {"fields": ["orderId"]}
+// Records stored from then on are upserted on these fields. Records stored earlier keep
+// no key and are not matched.
+func PutNaturalKeyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	claims, ok := r.Context().Value(UserClaimsKey).(*utils.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req naturalKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if len(req.Fields) == 0 || len(req.Fields) > maxNaturalKeyFields {
+		http.Error(w, fmt.Sprintf("A natural key needs between 1 and %d fields", maxNaturalKeyFields), http.StatusBadRequest)
+		return
+	}
+	for _, field := range req.Fields {
+		if err := utils.ValidateFieldPath(field); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	recordType := r.PathValue("recordType")
+	recordTypeDB := db.NewRecordTypeDB(db.MongoClient, db.DatabaseName)
+	if err := recordTypeDB.SetNaturalKey(ctx, claims.UserID, recordType, req.Fields); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Natural key saved for record type " + recordType))
+}
+
+// e.g. DELETE /recordTypes/{recordType}/naturalKey
+func DeleteNaturalKeyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	claims, ok := r.Context().Value(UserClaimsKey).(*utils.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	recordTypeDB := db.NewRecordTypeDB(db.MongoClient, db.DatabaseName)
+	if err := recordTypeDB.SetNaturalKey(ctx, claims.UserID, r.PathValue("recordType"), nil); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// e.g. GET /recordTypes/{recordType}/transforms
+func GetTransformsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	claims, ok := r.Context().Value(UserClaimsKey).(*utils.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	recordTypeDB := db.NewRecordTypeDB(db.MongoClient, db.DatabaseName)
+	config, err := recordTypeDB.GetConfig(ctx, claims.UserID, r.PathValue("recordType"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if config == nil || len(config.Transforms) == 0 {
+		http.Error(w, "No transforms for this record type", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transformsRequest{Transforms: config.Transforms})
+}
+
+// e.g. PUT /recordTypes/{recordType}/transforms with
+// {"transforms": [{"op": "rename", "field": "qty", "to": "quantity"}, {"op": "compute", "field": "total", "expression": "price * quantity"}]}
+// The transforms replace the previous ones and run in order on every record uploaded from then on,
+// before it is validated.
+func PutTransformsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	claims, ok := r.Context().Value(UserClaimsKey).(*utils.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req transformsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if len(req.Transforms) == 0 || len(req.Transforms) > maxTransforms {
+		http.Error(w, fmt.Sprintf("Between 1 and %d transforms are needed", maxTransforms), http.StatusBadRequest)
+		return
+	}
+	if _, err := parsers.CompileTransforms(req.Transforms); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	recordType := r.PathValue("recordType")
+	recordTypeDB := db.NewRecordTypeDB(db.MongoClient, db.DatabaseName)
+	if err := recordTypeDB.SetTransforms(ctx, claims.UserID, recordType, req.Transforms); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Transforms saved for record type " + recordType))
+}
+
+// e.g. DELETE /recordTypes/{recordType}/transforms
+func DeleteTransformsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	claims, ok := r.Context().Value(UserClaimsKey).(*utils.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	recordTypeDB := db.NewRecordTypeDB(db.MongoClient, db.DatabaseName)
+	if err := recordTypeDB.SetTransforms(ctx, claims.UserID, r.PathValue("recordType"), nil); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// e.g. GET /recordTypes/{recordType}/eventTime
+func GetEventTimeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	claims, ok := r.Context().Value(UserClaimsKey).(*utils.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	recordTypeDB := db.NewRecordTypeDB(db.MongoClient, db.DatabaseName)
+	config, err := recordTypeDB.GetConfig(ctx, claims.UserID, r.PathValue("recordType"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if config == nil || config.EventTime == nil {
+		http.Error(w, "No event time for this record type", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(config.EventTime)
+}
+
+// e.g. PUT /recordTypes/{recordType}/eventTime with {"field": "orderedAt", "layout": "02/01/2006"}
+// Records stored from then on carry the parsed time as "eventTime" next to their ingestion
+// "timestamp"; records whose event time is missing or unreadable are quarantined.
+func PutEventTimeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	claims, ok := r.Context().Value(UserClaimsKey).(*utils.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.EventTime
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if err := parsers.ValidateEventTime(req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	recordType := r.PathValue("recordType")
+	recordTypeDB := db.NewRecordTypeDB(db.MongoClient, db.DatabaseName)
+	if err := recordTypeDB.SetEventTime(ctx, claims.UserID, recordType, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Event time saved for record type " + recordType))
+}
+
+// e.g. DELETE /recordTypes/{recordType}/eventTime
+func DeleteEventTimeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	claims, ok := r.Context().Value(UserClaimsKey).(*utils.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	recordTypeDB := db.NewRecordTypeDB(db.MongoClient, db.DatabaseName)
+	if err := recordTypeDB.SetEventTime(ctx, claims.UserID, r.PathValue("recordType"), nil); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loadRecordTypeRules loads the natural keys, transforms and event time settings of the given
+// record types into opts. Record types without a setting are left out of the matching map.
+func loadRecordTypeRules(ctx context.Context, opts *parsers.ParseOptions, recordTypes []string) error {
+	recordTypeDB := db.NewRecordTypeDB(db.MongoClient, db.DatabaseName)
+	opts.NaturalKeys = make(map[string][]string)
+	opts.Transforms = make(map[string]*parsers.TransformPipeline)
+	opts.EventTimes = make(map[string]*models.EventTime)
+	loaded := make(map[string]bool)
+	for _, recordType := range recordTypes {
+		if loaded[recordType] {
+			continue
+		}
+		loaded[recordType] = true
+
+		config, err := recordTypeDB.GetConfig(ctx, opts.UserID, recordType)
+		if err != nil {
+			return err
+		}
+		if config == nil {
+			continue
+		}
+		if len(config.NaturalKey) > 0 {
+			opts.NaturalKeys[recordType] = config.NaturalKey
+		}
+		if len(config.Transforms) > 0 {
+			pipeline, err := parsers.CompileTransforms(config.Transforms)
+			if err != nil {
+				return fmt.Errorf("invalid transforms for record type %s: %w", recordType, err)
+			}
+			opts.Transforms[recordType] = pipeline
+		}
+		if config.EventTime != nil {
+			opts.EventTimes[recordType] = config.EventTime
+		}
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/vd09-projects/my-documentdb-system/internal/db"
+	"github.com/vd09-projects/my-documentdb-system/internal/jobs"
+	"github.com/vd09-projects/my-documentdb-system/internal/models"
+	"github.com/vd09-projects/my-documentdb-system/internal/parsers"
+	"github.com/vd09-projects/my-documentdb-system/internal/utils"
+)
+
+// e.g. POST /uploads/{id}/reingest with form fields such as recordType=orders or columnTypes={...}
+// Parses the stored file of an upload again, with the current validation rules and with the
+// given settings in place of the original ones. The new records are staged and, once the file
+// has been parsed, replace the records of the original upload in one transaction. A
+// re-ingestion that fails, or is too large to publish, leaves the original records untouched.
+// Only one re-ingestion of an upload runs at a time.
+func ReingestUploadHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	claims, ok := r.Context().Value(UserClaimsKey).(*utils.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := r.ParseMultipartForm(1 << 20); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		http.Error(w, "Could not parse form", http.StatusBadRequest)
+		return
+	}
+
+	id := r.PathValue("id")
+	if job, ok := jobs.UploadQueue.Get(id, claims.UserID); ok && !job.Finished() {
+		http.Error(w, "Upload is still running; wait for it or cancel it first", http.StatusConflict)
+		return
+	}
+
+	uploadDB := db.NewUploadDB(db.MongoClient, db.DatabaseName)
+	original, err := uploadDB.GetUpload(ctx, claims.UserID, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if original == nil {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return
+	}
+	if original.FileID.IsZero() {
+		http.Error(w, "The file of this upload was not kept", http.StatusConflict)
+		return
+	}
+	if original.Status == db.UploadStatusReplaced {
+		http.Error(w, "Upload was already replaced by "+original.ReplacedBy+"; re-ingest that upload instead", http.StatusConflict)
+		return
+	}
+	// A claim is stale once its re-ingestion is no longer running, e.g. after a restart
+	stale := original.ReplacingBy
+	if running, ok := jobs.UploadQueue.Get(stale, claims.UserID); ok && !running.Finished() {
+		http.Error(w, "Upload is already being re-ingested by "+stale, http.StatusConflict)
+		return
+	}
+
+	opts, err := parseOptionsFromForm(r, claims.UserID, original.Options)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := loadValidationRules(ctx, &opts); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	job := jobs.NewJob(claims.UserID, opts.RecordType, original.FileName)
+	opts.BatchID = job.ID()
+	opts.FileName = original.FileName
+	opts.UploadedBy = claims.Username
+
+	fileDB, err := db.NewFileDB(db.MongoClient, db.DatabaseName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	database := db.NewRecordDB(db.MongoClient, db.DatabaseName)
+	staging := db.NewStagingRecordDB(db.MongoClient, db.DatabaseName)
+	// Uploads stored before formats were recorded only ever had a recognised extension
+	format, ok := parsers.FormatByNames(original.Format, original.Compression)
+	if !ok {
+		format, ok = parsers.DetectFormat(original.FileName, "", nil)
+	}
+	if !ok {
+		http.Error(w, parsers.UnsupportedFormatError().Error(), http.StatusBadRequest)
+		return
+	}
+	parser := format.New(jobs.TrackProgress(staging, job))
+
+	claimed, err := uploadDB.ClaimReplacement(ctx, claims.UserID, original.ID, stale, job.ID())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !claimed {
+		http.Error(w, "Upload is already being re-ingested or was replaced", http.StatusConflict)
+		return
+	}
+	release := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := uploadDB.ReleaseReplacement(ctx, claims.UserID, original.ID, job.ID()); err != nil {
+			log.Printf("Failed to release upload %s from re-ingestion %s: %v", original.ID, job.ID(), err)
+		}
+	}
+
+	if _, err := uploadDB.CreateUpload(ctx, models.Upload{
+		ID:          job.ID(),
+		UserID:      claims.UserID,
+		RecordType:  opts.RecordType,
+		FileName:    original.FileName,
+		FileHash:    original.FileHash,
+		Format:      format.Name,
+		Compression: format.Compression,
+		UploadedBy:  claims.Username,
+		FileID:      original.FileID,
+		Options:     uploadOptions(opts),
+		Replaces:    original.ID,
+		Status:      string(jobs.StatusQueued),
+		CreatedAt:   time.Now(),
+	}); err != nil {
+		release()
+		http.Error(w, "Failed to record upload", http.StatusInternalServerError)
+		return
+	}
+
+	publish := func(ctx context.Context) error {
+		// Both uploads are updated in the transaction that switches the records
+		commit := func(ctx context.Context) error {
+			if err := uploadDB.MarkReplaced(ctx, claims.UserID, original.ID, job.ID()); err != nil {
+				return err
+			}
+			snap := job.Snapshot()
+			return uploadDB.FinishUpload(ctx, job.ID(), string(jobs.StatusCompleted), snap.Inserted, snap.Quarantined, true)
+		}
+		result, err := database.PublishStagedBatch(ctx, claims.UserID, job.ID(), original.ID, commit)
+		if result == nil {
+			return err
+		}
+		// The records are already switched, so a failure here only leaves unused fields listed
+		if err != nil {
+			log.Printf("Failed to prune fields after upload %s replaced %s: %v", job.ID(), original.ID, err)
+		}
+		return nil
+	}
+	run := ingestRun(fileDB, original.FileID, parser, opts, publish)
+	cleanup := func() {
+		if job.Snapshot().Status != jobs.StatusCompleted {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if err := database.DiscardStagedBatch(ctx, claims.UserID, job.ID()); err != nil {
+				log.Printf("Failed to discard staged records of upload %s: %v", job.ID(), err)
+			}
+			release()
+		}
+		recordUploadOutcome(uploadDB, job)
+	}
+
+	if err := jobs.UploadQueue.Submit(job, run, cleanup); err != nil {
+		if errors.Is(err, jobs.ErrQueueFull) {
+			http.Error(w, "Too many uploads in progress, try again later", http.StatusServiceUnavailable)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job.Snapshot())
+}
+
+// RecoverReingestions rolls back the re-ingestions that a restart interrupted. Records are
+// switched in one transaction together with the upload statuses, so an upload still claimed
+// was never replaced: the staged records of its re-ingestion are discarded, the re-ingestion
+// is marked failed and the claim is released. Staged records that a failed cleanup left
+// without a claim are discarded too. It must run before the upload workers start.
+func RecoverReingestions(ctx context.Context) error {
+	uploadDB := db.NewUploadDB(db.MongoClient, db.DatabaseName)
+	database := db.NewRecordDB(db.MongoClient, db.DatabaseName)
+
+	claimed, err := uploadDB.ListReplacementClaims(ctx)
+	if err != nil {
+		return err
+	}
+	for _, original := range claimed {
+		if err := database.DiscardStagedBatch(ctx, original.UserID, original.ReplacingBy); err != nil {
+			return err
+		}
+		if err := uploadDB.FinishUpload(ctx, original.ReplacingBy, string(jobs.StatusFailed), 0, 0, false); err != nil {
+			return err
+		}
+		if err := uploadDB.ReleaseReplacement(ctx, original.UserID, original.ID, original.ReplacingBy); err != nil {
+			return err
+		}
+		log.Printf("Rolled back re-ingestion %s of upload %s", original.ReplacingBy, original.ID)
+	}
+
+	batches, err := database.StagedBatches(ctx)
+	if err != nil {
+		return err
+	}
+	for _, batch := range batches {
+		if err := database.DiscardStagedBatch(ctx, batch.UserID, batch.BatchID); err != nil {
+			return err
+		}
+		log.Printf("Discarded staged records of re-ingestion %s", batch.BatchID)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/vd09-projects/my-documentdb-system/internal/db"
+	"github.com/vd09-projects/my-documentdb-system/internal/jobs"
+	"github.com/vd09-projects/my-documentdb-system/internal/models"
+	"github.com/vd09-projects/my-documentdb-system/internal/parsers"
+	"github.com/vd09-projects/my-documentdb-system/internal/utils"
+)
+
+// RevalidationResult summarises a quarantine re-validation job.
+type RevalidationResult struct {
+	Promoted     int `json:"promoted"`
+	StillFailing int `json:"stillFailing"`
+	// Skipped counts records whose data is not an object, such as raw CSV rows. They can only be
+	// resubmitted after editing and are left untouched, keeping their original error.
+	Skipped int `json:"skipped"`
+	// Codes and Reasons count the records that still fail by their new error code and reason.
+	Codes   map[string]int `json:"codes"`
+	Reasons map[string]int `json:"reasons"`
+}
+
+// e.g. POST /quarantine/revalidations?recordType=orders
+// Queues a job that reruns every quarantined record of the record type through validation.
+// Records that pass move to valid_records; the others are updated in place with their new reason.
+// Records that are not objects, such as raw CSV rows, are skipped.
+func RevalidateQuarantineHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(UserClaimsKey).(*utils.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	recordType := r.URL.Query().Get("recordType")
+	if recordType == "" {
+		http.Error(w, "Record type is required", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	opts := parsers.ParseOptions{UserID: claims.UserID, RecordType: recordType}
+	if err := loadValidationRules(ctx, &opts); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rules := opts.Rules(recordType)
+
+	job := jobs.NewJob(claims.UserID, recordType, "")
+	quarantineDB := db.NewQuarantineDB(db.MongoClient, db.DatabaseName)
+	database := jobs.TrackProgress(db.NewRecordDB(db.MongoClient, db.DatabaseName), job)
+
+	run := func(ctx context.Context, job *jobs.Job) (interface{}, error) {
+		result := &RevalidationResult{Codes: make(map[string]int), Reasons: make(map[string]int)}
+		err := quarantineDB.EachQuarantine(ctx, claims.UserID, recordType, func(record models.QuarantineRecord) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if _, isObject := record.Data.(map[string]interface{}); !isObject {
+				result.Skipped++
+				return nil
+			}
+
+			valid, recordErr := revalidateQuarantined(record, rules)
+			if recordErr != nil {
+				// Records that still fail stay where they are, keeping their ID and timestamp
+				if err := quarantineDB.UpdateQuarantineError(ctx, claims.UserID, record.ID, *recordErr); err != nil {
+					return err
+				}
+				job.AddQuarantined(1)
+				result.StillFailing++
+				result.Codes[recordErr.Code]++
+				result.Reasons[recordErr.Reason]++
+				return nil
+			}
+
+			promoted, err := quarantineDB.RequeueQuarantine(ctx, claims.UserID, record.ID, func(record models.QuarantineRecord) error {
+				return database.InsertToValid(ctx, valid, record.UserID, record.RecordType)
+			})
+			if err != nil {
+				return err
+			}
+			if promoted {
+				result.Promoted++
+			}
+			return nil
+		})
+		return result, err
+	}
+
+	if err := jobs.RevalidationQueue.Submit(job, run, nil); err != nil {
+		if errors.Is(err, jobs.ErrQueueFull) {
+			http.Error(w, "Too many revalidations in progress, try again later", http.StatusServiceUnavailable)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job.Snapshot())
+}
+
+// e.g. GET /quarantine/revalidations/{id}
+func RevalidationStatusHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(UserClaimsKey).(*utils.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	job, ok := jobs.RevalidationQueue.Get(r.PathValue("id"), claims.UserID)
+	if !ok {
+		http.Error(w, "Revalidation not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job.Snapshot())
+}
+
+// e.g. POST /quarantine/revalidations/{id}/cancel
+func CancelRevalidationHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(UserClaimsKey).(*utils.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	job, ok := jobs.RevalidationQueue.Get(r.PathValue("id"), claims.UserID)
+	if !ok {
+		http.Error(w, "Revalidation not found", http.StatusNotFound)
+		return
+	}
+
+	if !job.Cancel() {
+		http.Error(w, "Revalidation already finished", http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job.Snapshot())
+}
@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/vd09-projects/my-documentdb-system/internal/db"
+	"github.com/vd09-projects/my-documentdb-system/internal/models"
+	"github.com/vd09-projects/my-documentdb-system/internal/utils"
+)
+
+// maxSchemaSize bounds the size of an uploaded JSON Schema document.
+const maxSchemaSize = 1 << 20 // 1MB
+
+type schemaResponse struct {
+	RecordType string          `json:"recordType"`
+	Version    int             `json:"version"`
+	Schema     json.RawMessage `json:"schema,omitempty"`
+	Removed    bool            `json:"removed,omitempty"`
+	CreatedAt  time.Time       `json:"createdAt"`
+}
+
+func newSchemaResponse(schema models.RecordSchema) schemaResponse {
+	resp := schemaResponse{
+		RecordType: schema.RecordType,
+		Version:    schema.Version,
+		Removed:    schema.Removed,
+		CreatedAt:  schema.CreatedAt,
+	}
+	if !schema.Removed {
+		resp.Schema = json.RawMessage(schema.Schema)
+	}
+	return resp
+}
+
+// e.g. GET /schemas
+func ListSchemasHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	claims, ok := r.Context().Value(UserClaimsKey).(*utils.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	schemaDB := db.NewSchemaDB(db.MongoClient, db.DatabaseName)
+	schemas, err := schemaDB.ListSchemas(ctx, claims.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]schemaResponse, 0, len(schemas))
+	for _, schema := range schemas {
+		resp = append(resp, newSchemaResponse(schema))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// e.g. GET /schemas/{recordType}
+func GetSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	claims, ok := r.Context().Value(UserClaimsKey).(*utils.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	schemaDB := db.NewSchemaDB(db.MongoClient, db.DatabaseName)
+	schema, err := schemaDB.GetSchema(ctx, claims.UserID, r.PathValue("recordType"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if schema == nil {
+		http.Error(w, "No schema for this record type", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newSchemaResponse(*schema))
+}
+
+// e.g. PUT /schemas/{recordType} with a JSON Schema (draft 2020-12) as the body.
+// Every save creates a new version; earlier versions are kept.
+func PutSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	claims, ok := r.Context().Value(UserClaimsKey).(*utils.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	raw, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSchemaSize))
+	if err != nil {
+		http.Error(w, "Failed to read schema", http.StatusBadRequest)
+		return
+	}
+
+	// Reject schemas that would fail every upload later on
+	if _, err := utils.CompileSchema(raw); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON Schema: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	recordType := r.PathValue("recordType")
+	schemaDB := db.NewSchemaDB(db.MongoClient, db.DatabaseName)
+	version, err := schemaDB.SaveSchema(ctx, claims.UserID, recordType, string(raw))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf("Schema version %d saved for record type %s", version, recordType)))
+}
+
+// e.g. DELETE /schemas/{recordType}
+// Detaches the schema; the version history is kept.
+func DeleteSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	claims, ok := r.Context().Value(UserClaimsKey).(*utils.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	schemaDB := db.NewSchemaDB(db.MongoClient, db.DatabaseName)
+	removed, err := schemaDB.RemoveSchema(ctx, claims.UserID, r.PathValue("recordType"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !removed {
+		http.Error(w, "No schema for this record type", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type schemaVersionSummary struct {
+	Version   int       `json:"version"`
+	Removed   bool      `json:"removed,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Records is the number of valid records stamped with this version.
+	Records int64 `json:"records"`
+}
+
+// e.g. GET /schemas/{recordType}/versions
+// Lists every version with the number of valid records validated against it.
+// Records stored while the record type had no schema are counted as unversioned.
+func ListSchemaVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	claims, ok := r.Context().Value(UserClaimsKey).(*utils.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	recordType := r.PathValue("recordType")
+	schemaDB := db.NewSchemaDB(db.MongoClient, db.DatabaseName)
+	versions, err := schemaDB.ListSchemaVersions(ctx, claims.UserID, recordType)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(versions) == 0 {
+		http.Error(w, "No schema for this record type", http.StatusNotFound)
+		return
+	}
+
+	counts, err := schemaDB.CountRecordsBySchemaVersion(ctx, claims.UserID, recordType)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	summaries := make([]schemaVersionSummary, 0, len(versions))
+	for _, version := range versions {
+		summaries = append(summaries, schemaVersionSummary{
+			Version:   version.Version,
+			Removed:   version.Removed,
+			CreatedAt: version.CreatedAt,
+			Records:   counts[version.Version],
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"recordType":         recordType,
+		"versions":           summaries,
+		"unversionedRecords": counts[0],
+	})
+}
+
+// e.g. GET /schemas/{recordType}/versions/{version}
+func GetSchemaVersionHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	claims, ok := r.Context().Value(UserClaimsKey).(*utils.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	version, err := strconv.Atoi(r.PathValue("version"))
+	if err != nil {
+		http.Error(w, "Invalid version", http.StatusBadRequest)
+		return
+	}
+
+	schemaDB := db.NewSchemaDB(db.MongoClient, db.DatabaseName)
+	schema, err := schemaDB.GetSchemaVersion(ctx, claims.UserID, r.PathValue("recordType"), version)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if schema == nil {
+		http.Error(w, "Schema version not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(newSchemaResponse(*schema))
+}
+
+// e.g. GET /schemas/{recordType}/compare?from=1&to=2
+// Lists the changes between two versions as JSON pointers into the schema documents.
+// A removed version compares as a null schema.
+func CompareSchemaVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	claims, ok := r.Context().Value(UserClaimsKey).(*utils.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	from, errFrom := strconv.Atoi(r.URL.Query().Get("from"))
+	to, errTo := strconv.Atoi(r.URL.Query().Get("to"))
+	if errFrom != nil || errTo != nil {
+		http.Error(w, "Query parameters from and to must be schema versions", http.StatusBadRequest)
+		return
+	}
+
+	recordType := r.PathValue("recordType")
+	schemaDB := db.NewSchemaDB(db.MongoClient, db.DatabaseName)
+	docs := make([]interface{}, 2)
+	for i, version := range []int{from, to} {
+		schema, err := schemaDB.GetSchemaVersion(ctx, claims.UserID, recordType, version)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if schema == nil {
+			http.Error(w, fmt.Sprintf("Schema version %d not found", version), http.StatusNotFound)
+			return
+		}
+		if schema.Removed {
+			continue
+		}
+		decoder := json.NewDecoder(bytes.NewReader([]byte(schema.Schema)))
+		decoder.UseNumber()
+		if err := decoder.Decode(&docs[i]); err != nil {
+			http.Error(w, fmt.Sprintf("Schema version %d is not valid JSON", version), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"recordType": recordType,
+		"from":       from,
+		"to":         to,
+		"changes":    utils.DiffJSON(docs[0], docs[1]),
+	})
+}
+
+// loadRecordSchemas compiles the current schemas attached to the given record types.
+// Record types without a schema are left out of the result.
+func loadRecordSchemas(ctx context.Context, userID string, recordTypes []string) (map[string]*utils.VersionedSchema, error) {
+	schemaDB := db.NewSchemaDB(db.MongoClient, db.DatabaseName)
+	schemas := make(map[string]*utils.VersionedSchema)
+	for _, recordType := range recordTypes {
+		if _, done := schemas[recordType]; done {
+			continue
+		}
+		stored, err := schemaDB.GetSchema(ctx, userID, recordType)
+		if err != nil {
+			return nil, err
+		}
+		if stored == nil {
+			continue
+		}
+		compiled, err := utils.CompileSchema([]byte(stored.Schema))
+		if err != nil {
+			return nil, fmt.Errorf("schema version %d of record type %q no longer compiles: %w", stored.Version, recordType, err)
+		}
+		schemas[recordType] = &utils.VersionedSchema{Version: stored.Version, Schema: compiled}
+	}
+	return schemas, nil
+}
@@ -2,51 +2,712 @@ package handlers
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/vd09-projects/my-documentdb-system/internal/db"
+	"github.com/vd09-projects/my-documentdb-system/internal/jobs"
+	"github.com/vd09-projects/my-documentdb-system/internal/models"
 	"github.com/vd09-projects/my-documentdb-system/internal/parsers"
 	"github.com/vd09-projects/my-documentdb-system/internal/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// maxIdempotencyKeyLength bounds the Idempotency-Key header.
+const maxIdempotencyKeyLength = 255
+
+// DefaultMaxUploadSize is the largest upload request in bytes for users without their own limit.
+var DefaultMaxUploadSize int64 = 100 << 20 // 100MB
+
+// UserMaxUploadSizes overrides DefaultMaxUploadSize for the named users, in bytes.
+var UserMaxUploadSizes = map[string]int64{}
+
+// maxUploadFieldsSize bounds the form fields sent along with a multipart upload.
+const maxUploadFieldsSize = 1 << 20 // 1MB
+
+// UploadHandler validates the upload, queues it as a background job and returns the job ID.
+// Progress is available from GET /uploads/{id}. Retrying an upload, detected by its
+// Idempotency-Key header or otherwise by the file contents, returns the original upload.
+// With dryRun=true the file is only previewed, see previewUpload.
+// The file is streamed from the request, see readUploadRequest, up to the user's size limit.
 func UploadHandler(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseMultipartForm(10 << 20) // 10MB
+	// Retrieve claims from context
+	claims, ok := r.Context().Value(UserClaimsKey).(*utils.Claims)
+	if !ok {
+		http.Error(w, "Missing user info in context", http.StatusUnauthorized)
+		return
+	}
+
+	schemaCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	maxSize := maxUploadSize(claims.Username)
+	if r.ContentLength > maxSize {
+		http.Error(w, uploadTooLargeMessage(maxSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+
+	file, fileName, contentType, err := readUploadRequest(r)
+	if err != nil {
+		uploadReadError(w, err)
+		return
+	}
+
+	opts, err := parseOptionsFromForm(r, claims.UserID, models.UploadOptions{})
 	if err != nil {
-		http.Error(w, "Could not parse multipart form", http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	file, fileHeader, err := r.FormFile("datafile")
+	// The format is recognised by extension, then by content type, then by content; compressed
+	// files by the format they hold
+	format, content, ok, err := parsers.Detect(fileName, contentType, file)
 	if err != nil {
-		http.Error(w, "No file uploaded", http.StatusBadRequest)
+		uploadReadError(w, fmt.Errorf("Could not read uploaded file: %w", err))
+		return
+	}
+	if !ok {
+		http.Error(w, parsers.UnsupportedFormatError().Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := loadValidationRules(schemaCtx, &opts); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer file.Close()
+
+	if value := r.FormValue("dryRun"); value != "" {
+		dryRun, err := strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, "Invalid dryRun value", http.StatusBadRequest)
+			return
+		}
+		if dryRun {
+			opts.UploadedBy = claims.Username
+			previewUpload(w, r, content, fileName, format, opts)
+			return
+		}
+	}
+
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		http.Error(w, "Idempotency-Key is too long", http.StatusBadRequest)
+		return
+	}
+
+	job := jobs.NewJob(claims.UserID, opts.RecordType, fileName)
+	opts.BatchID = job.ID()
+	opts.FileName = fileName
+	opts.UploadedBy = claims.Username
+
 	database := db.NewRecordDB(db.MongoClient, db.DatabaseName)
+	parser := format.New(jobs.TrackProgress(database, job))
+
+	// The multipart file is removed once this request returns, so the job reads the copy kept in GridFS
+	fileDB, err := db.NewFileDB(db.MongoClient, db.DatabaseName)
+	if err != nil {
+		http.Error(w, "Failed to store upload", http.StatusInternalServerError)
+		return
+	}
+	hash := sha256.New()
+	fileID, err := fileDB.SaveFile(fileName, claims.UserID, job.ID(), io.TeeReader(content, hash))
+	if err != nil {
+		if isUploadTooLarge(w, err) {
+			return
+		}
+		http.Error(w, "Failed to store upload", http.StatusInternalServerError)
+		return
+	}
+	fileHash := hex.EncodeToString(hash.Sum(nil))
+	deleteFile := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := fileDB.DeleteFile(ctx, fileID); err != nil {
+			log.Printf("Failed to delete upload file %s: %v", fileID.Hex(), err)
+		}
+	}
 
-	fileName := fileHeader.Filename
-	parser := parsers.GetParser(fileName, database)
-	if parser == nil {
-		http.Error(w, "Unsupported file type. Upload CSV or JSON", http.StatusBadRequest)
+	existing, err := queueUpload(job, models.Upload{
+		ID:             job.ID(),
+		UserID:         claims.UserID,
+		RecordType:     opts.RecordType,
+		FileName:       fileName,
+		FileHash:       fileHash,
+		Format:         format.Name,
+		Compression:    format.Compression,
+		UploadedBy:     claims.Username,
+		FileID:         fileID,
+		Options:        uploadOptions(opts),
+		IdempotencyKey: idempotencyKey,
+		DedupeKey:      uploadDedupeKey(idempotencyKey, fileHash, opts),
+		Status:         string(jobs.StatusQueued),
+		CreatedAt:      time.Now(),
+	}, fileDB, parser, opts, deleteFile)
+	if errors.Is(err, jobs.ErrQueueFull) {
+		http.Error(w, "Too many uploads in progress, try again later", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		deleteFile()
+		http.Error(w, "Failed to record upload", http.StatusInternalServerError)
+		return
+	}
+	if existing != nil {
+		deleteFile()
+		writeReplayedUpload(w, *existing)
 		return
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job.Snapshot())
+}
+
+// queueUpload records an upload whose file is kept in GridFS and queues the job that ingests it.
+// A retry of an upload that is running or completed queues nothing and returns that upload
+// instead. forget, if not nil, runs when the job is rejected before it ran, e.g. with
+// jobs.ErrQueueFull.
+func queueUpload(job *jobs.Job, upload models.Upload, fileDB *db.FileDB, parser parsers.Parser, opts parsers.ParseOptions, forget func()) (*models.Upload, error) {
+	// Streaming a large file may outlast the caller's context
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	uploadDB := db.NewUploadDB(db.MongoClient, db.DatabaseName)
+	existing, err := uploadDB.CreateUpload(ctx, upload)
+	if err != nil || existing != nil {
+		return existing, err
+	}
+
+	run := ingestRun(fileDB, upload.FileID, parser, opts, nil)
+	cleanup := func() {
+		if !recordUploadOutcome(uploadDB, job) && forget != nil {
+			forget()
+		}
+	}
+	return nil, jobs.UploadQueue.Submit(job, run, cleanup)
+}
+
+// writeReplayedUpload answers a retried upload with the upload it repeats.
+func writeReplayedUpload(w http.ResponseWriter, existing models.Upload) {
+	snapshot := uploadSnapshot(existing)
+	if existingJob, ok := jobs.UploadQueue.Get(existing.ID, existing.UserID); ok {
+		snapshot = existingJob.Snapshot()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Idempotent-Replayed", "true")
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+// e.g. GET /uploads/{id}
+// Jobs are kept in memory for a day; older uploads are read back from the uploads collection.
+func UploadStatusHandler(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// Retrieve claims from context
 	claims, ok := r.Context().Value(UserClaimsKey).(*utils.Claims)
 	if !ok {
-		http.Error(w, "Missing user info in context", http.StatusUnauthorized)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	uploadDB := db.NewUploadDB(db.MongoClient, db.DatabaseName)
+	upload, err := uploadDB.GetUpload(ctx, claims.UserID, r.PathValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	job, running := jobs.UploadQueue.Get(r.PathValue("id"), claims.UserID)
+	if !running && upload == nil {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(uploadResponse(upload, job))
+}
+
+// e.g. GET /uploads?limit=50&offset=0
+func ListUploadsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	claims, ok := r.Context().Value(UserClaimsKey).(*utils.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	limit, offset, err := parsePage(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	uploadDB := db.NewUploadDB(db.MongoClient, db.DatabaseName)
+	uploads, total, err := uploadDB.ListUploads(ctx, claims.UserID, limit, offset)
+	if err != nil {
+		http.Error(w, "Failed to query uploads", http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]uploadSummary, 0, len(uploads))
+	for i := range uploads {
+		job, _ := jobs.UploadQueue.Get(uploads[i].ID, claims.UserID)
+		resp = append(resp, uploadResponse(&uploads[i], job))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"total":   total,
+		"uploads": resp,
+	})
+}
+
+// e.g. DELETE /uploads/{id}
+// Rolls back an upload: every valid and quarantined record it stored is deleted and fields
+// no longer backed by any record are pruned from record_fields. Records a later upload
+// replaced through a natural key belong to that later upload and are kept.
+func RollbackUploadHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	claims, ok := r.Context().Value(UserClaimsKey).(*utils.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id := r.PathValue("id")
+	if job, ok := jobs.UploadQueue.Get(id, claims.UserID); ok && !job.Finished() {
+		http.Error(w, "Upload is still running; cancel it first", http.StatusConflict)
+		return
+	}
+
+	uploadDB := db.NewUploadDB(db.MongoClient, db.DatabaseName)
+	upload, err := uploadDB.GetUpload(ctx, claims.UserID, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if upload == nil {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return
+	}
+
+	database := db.NewRecordDB(db.MongoClient, db.DatabaseName)
+	result, err := database.RollbackBatch(ctx, claims.UserID, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := uploadDB.MarkRolledBack(ctx, claims.UserID, id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// e.g. POST /uploads/{id}/cancel
+func CancelUploadHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(UserClaimsKey).(*utils.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	job, ok := jobs.UploadQueue.Get(r.PathValue("id"), claims.UserID)
+	if !ok {
+		http.Error(w, "Upload not found", http.StatusNotFound)
 		return
 	}
 
-	recordType := r.FormValue("recordType")
-	if recordType == "" {
-		http.Error(w, "Record type is required", http.StatusBadRequest)
+	if !job.Cancel() {
+		http.Error(w, "Upload already finished", http.StatusConflict)
 		return
 	}
 
-	parser.Parse(ctx, file, w, claims.UserID, recordType)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job.Snapshot())
+}
+
+// readUploadRequest returns the file of an upload request without buffering it. A multipart
+// request carries the file in its datafile part; the fields before that part are read into
+// r.Form together with the query parameters, so settings must precede the file. Any other
+// request is a raw upload: the body is the file, its Content-Type names the format and the
+// settings, including an optional fileName, are query parameters.
+func readUploadRequest(r *http.Request) (file io.Reader, fileName, contentType string, err error) {
+	r.Form = r.URL.Query()
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		fileName = r.Form.Get("fileName")
+		if fileName == "" {
+			fileName = "upload"
+		}
+		return r.Body, fileName, r.Header.Get("Content-Type"), nil
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, "", "", errors.New("Could not parse multipart form")
+	}
+	fieldsSize := int64(0)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, "", "", errors.New("No file uploaded")
+		}
+		if err != nil {
+			return nil, "", "", fmt.Errorf("Could not parse multipart form: %w", err)
+		}
+		name := part.FormName()
+		if name == "datafile" {
+			return part, part.FileName(), part.Header.Get("Content-Type"), nil
+		}
+		if name == "" || part.FileName() != "" {
+			continue
+		}
+
+		value, err := io.ReadAll(io.LimitReader(part, maxUploadFieldsSize-fieldsSize+1))
+		if err != nil {
+			return nil, "", "", fmt.Errorf("Could not parse multipart form: %w", err)
+		}
+		fieldsSize += int64(len(value))
+		if fieldsSize > maxUploadFieldsSize {
+			return nil, "", "", errors.New("Form fields are too large")
+		}
+		r.Form.Add(name, string(value))
+	}
+}
+
+// maxUploadSize returns the largest upload request the user may send.
+func maxUploadSize(username string) int64 {
+	if maxSize, ok := UserMaxUploadSizes[username]; ok {
+		return maxSize
+	}
+	return DefaultMaxUploadSize
+}
+
+// ParseUserUploadSizes reads per-user upload limits written as "alice=1073741824,bob=52428800".
+func ParseUserUploadSizes(value string) (map[string]int64, error) {
+	sizes := make(map[string]int64)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		username, size, found := strings.Cut(entry, "=")
+		maxSize, err := strconv.ParseInt(strings.TrimSpace(size), 10, 64)
+		if !found || strings.TrimSpace(username) == "" || err != nil || maxSize <= 0 {
+			return nil, fmt.Errorf("invalid upload limit %q, want username=bytes", entry)
+		}
+		sizes[strings.TrimSpace(username)] = maxSize
+	}
+	return sizes, nil
+}
+
+func uploadTooLargeMessage(maxSize int64) string {
+	return fmt.Sprintf("Upload exceeds the limit of %d bytes", maxSize)
+}
+
+// isUploadTooLarge answers with 413 and returns true when err comes from reading past the size limit.
+func isUploadTooLarge(w http.ResponseWriter, err error) bool {
+	var tooLarge *http.MaxBytesError
+	if !errors.As(err, &tooLarge) {
+		return false
+	}
+	http.Error(w, uploadTooLargeMessage(tooLarge.Limit), http.StatusRequestEntityTooLarge)
+	return true
+}
+
+// uploadReadError answers a request whose file could not be read.
+func uploadReadError(w http.ResponseWriter, err error) {
+	if !isUploadTooLarge(w, err) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+// ingestRun returns the job that parses a stored file. publish, if not nil, runs once the
+// file has been parsed successfully.
+func ingestRun(fileDB *db.FileDB, fileID primitive.ObjectID, parser parsers.Parser, opts parsers.ParseOptions, publish func(ctx context.Context) error) jobs.RunFunc {
+	return func(ctx context.Context, job *jobs.Job) (interface{}, error) {
+		f, err := fileDB.OpenFile(fileID)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		result, err := parser.Parse(ctx, f, opts)
+		if err != nil {
+			return nil, err
+		}
+		if publish != nil {
+			if err := publish(ctx); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	}
+}
+
+// recordUploadOutcome stores how an upload ended. Uploads rejected before they ran are
+// forgotten; it returns false for them.
+func recordUploadOutcome(uploadDB *db.UploadDB, job *jobs.Job) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	snap := job.Snapshot()
+	ran := snap.Status != jobs.StatusQueued
+	var err error
+	if ran {
+		err = uploadDB.FinishUpload(ctx, snap.ID, string(snap.Status), snap.Inserted, snap.Quarantined, snap.Status == jobs.StatusCompleted)
+	} else {
+		err = uploadDB.DeleteUpload(ctx, snap.ID)
+	}
+	if err != nil {
+		log.Printf("Failed to record outcome of upload %s: %v", snap.ID, err)
+	}
+	return ran
+}
+
+// loadValidationRules loads the schemas and record type settings of the record types an upload writes to.
+func loadValidationRules(ctx context.Context, opts *parsers.ParseOptions) error {
+	recordTypes := []string{opts.RecordType}
+	for _, sheetRecordType := range opts.SheetRecordTypes {
+		recordTypes = append(recordTypes, sheetRecordType)
+	}
+	for _, entryRecordType := range opts.EntryRecordTypes {
+		recordTypes = append(recordTypes, entryRecordType)
+	}
+
+	var err error
+	opts.Schemas, err = loadRecordSchemas(ctx, opts.UserID, recordTypes)
+	if err != nil {
+		return err
+	}
+	return loadRecordTypeRules(ctx, opts, recordTypes)
+}
+
+// uploadOptions returns the parser settings of an upload in the form they are stored.
+func uploadOptions(opts parsers.ParseOptions) models.UploadOptions {
+	stored := models.UploadOptions{
+		RecordType:       opts.RecordType,
+		Sheet:            opts.Sheet,
+		SheetRecordTypes: opts.SheetRecordTypes,
+		RecordElement:    opts.RecordElement,
+		EntryRecordTypes: opts.EntryRecordTypes,
+		CSVDialect:       opts.CSVDialect,
+	}
+	if len(opts.ColumnTypes) > 0 {
+		stored.ColumnTypes = make(map[string]string, len(opts.ColumnTypes))
+		for column, columnType := range opts.ColumnTypes {
+			stored.ColumnTypes[column] = string(columnType)
+		}
+	}
+	return stored
+}
+
+// uploadDedupeKey identifies repeats of an upload: by the client's Idempotency-Key when sent,
+// otherwise by the file contents together with the options that decide where its rows go.
+func uploadDedupeKey(idempotencyKey, fileHash string, opts parsers.ParseOptions) string {
+	if idempotencyKey != "" {
+		return "key:" + idempotencyKey
+	}
+	// Maps are encoded with sorted keys, so equal options give equal JSON
+	target, _ := json.Marshal(map[string]interface{}{
+		"recordType":       opts.RecordType,
+		"sheet":            opts.Sheet,
+		"sheetRecordTypes": opts.SheetRecordTypes,
+		"recordElement":    opts.RecordElement,
+		"columnTypes":      opts.ColumnTypes,
+		"entryRecordTypes": opts.EntryRecordTypes,
+		"csvDialect":       opts.CSVDialect,
+	})
+	targetHash := sha256.Sum256(target)
+	return "file:" + fileHash + ":" + hex.EncodeToString(targetHash[:])
+}
+
+// uploadSummary is the API view of an upload: its job snapshot plus the stored batch details.
+type uploadSummary struct {
+	jobs.Snapshot
+	FileHash     string     `json:"fileHash,omitempty"`
+	Format       string     `json:"format,omitempty"`
+	Compression  string     `json:"compression,omitempty"`
+	UploadedBy   string     `json:"uploadedBy,omitempty"`
+	RolledBackAt *time.Time `json:"rolledBackAt,omitempty"`
+	Replaces     string     `json:"replaces,omitempty"`
+	ReplacedBy   string     `json:"replacedBy,omitempty"`
+}
+
+// uploadResponse combines a stored upload with its job. Either may be nil: the job is dropped
+// from memory a day after it finishes, and uploads rejected before they ran are not stored.
+func uploadResponse(upload *models.Upload, job *jobs.Job) uploadSummary {
+	var resp uploadSummary
+	if upload != nil {
+		resp = uploadSummary{
+			Snapshot:     uploadSnapshot(*upload),
+			FileHash:     upload.FileHash,
+			Format:       upload.Format,
+			Compression:  upload.Compression,
+			UploadedBy:   upload.UploadedBy,
+			RolledBackAt: upload.RolledBackAt,
+			Replaces:     upload.Replaces,
+			ReplacedBy:   upload.ReplacedBy,
+		}
+	}
+	// A live job has the current progress, unless the batch has since been rolled back or replaced
+	if job != nil && (upload == nil || (upload.RolledBackAt == nil && upload.ReplacedBy == "")) {
+		resp.Snapshot = job.Snapshot()
+	}
+	return resp
+}
+
+// uploadSnapshot describes a stored upload whose job is no longer held in memory.
+func uploadSnapshot(upload models.Upload) jobs.Snapshot {
+	return jobs.Snapshot{
+		ID:            upload.ID,
+		RecordType:    upload.RecordType,
+		FileName:      upload.FileName,
+		Status:        jobs.Status(upload.Status),
+		RowsProcessed: upload.Inserted + upload.Quarantined,
+		Inserted:      upload.Inserted,
+		Quarantined:   upload.Quarantined,
+		Errors:        []string{},
+		CreatedAt:     upload.CreatedAt,
+		FinishedAt:    upload.FinishedAt,
+	}
+}
+
+// parseOptionsFromForm reads the record type and the format specific parser settings of an upload.
+// Settings missing from the form keep their value in defaults, e.g. the options of a re-ingested upload.
+func parseOptionsFromForm(r *http.Request, userID string, defaults models.UploadOptions) (parsers.ParseOptions, error) {
+	opts := storedParseOptions(userID, defaults)
+
+	formValue := func(name string) (string, bool) {
+		values, ok := r.Form[name]
+		if !ok || len(values) == 0 {
+			return "", false
+		}
+		return values[0], true
+	}
+	if value, ok := formValue("recordType"); ok {
+		opts.RecordType = value
+	}
+	if value, ok := formValue("sheet"); ok {
+		opts.Sheet = value
+	}
+	if value, ok := formValue("recordElement"); ok {
+		opts.RecordElement = value
+	}
+
+	// Spreadsheets can pick a sheet, or map each sheet to its own record type
+	if mapping, ok := formValue("sheetRecordTypes"); ok {
+		opts.SheetRecordTypes = nil
+		if mapping != "" {
+			if err := json.Unmarshal([]byte(mapping), &opts.SheetRecordTypes); err != nil {
+				return opts, errors.New("Invalid sheetRecordTypes mapping")
+			}
+		}
+	}
+
+	// ZIP archives can map each entry to its own record type
+	if mapping, ok := formValue("entryRecordTypes"); ok {
+		opts.EntryRecordTypes = nil
+		if mapping != "" {
+			if err := json.Unmarshal([]byte(mapping), &opts.EntryRecordTypes); err != nil {
+				return opts, errors.New("Invalid entryRecordTypes mapping")
+			}
+		}
+	}
+
+	// Optional explicit CSV column types, e.g. {"quantity": "int", "price": "float"}
+	if columnTypes, ok := formValue("columnTypes"); ok {
+		opts.ColumnTypes = nil
+		if columnTypes != "" {
+			if err := json.Unmarshal([]byte(columnTypes), &opts.ColumnTypes); err != nil {
+				return opts, errors.New("Invalid columnTypes mapping")
+			}
+		}
+	}
+
+	// CSV dialect, e.g. delimiter=semicolon&encoding=windows-1252 or columns=["id","name"] for headerless files
+	dialect := &opts.CSVDialect
+	if value, ok := formValue("delimiter"); ok {
+		dialect.Delimiter = value
+	}
+	if value, ok := formValue("lazyQuotes"); ok {
+		dialect.LazyQuotes = false
+		if value != "" {
+			lazyQuotes, err := strconv.ParseBool(value)
+			if err != nil {
+				return opts, errors.New("Invalid lazyQuotes value")
+			}
+			dialect.LazyQuotes = lazyQuotes
+		}
+	}
+	if value, ok := formValue("comment"); ok {
+		dialect.Comment = value
+	}
+	if value, ok := formValue("skipRows"); ok {
+		dialect.SkipRows = 0
+		if value != "" {
+			skipRows, err := strconv.Atoi(value)
+			if err != nil {
+				return opts, errors.New("Invalid skipRows value")
+			}
+			dialect.SkipRows = skipRows
+		}
+	}
+	if value, ok := formValue("columns"); ok {
+		dialect.Columns = nil
+		if value != "" {
+			if err := json.Unmarshal([]byte(value), &dialect.Columns); err != nil {
+				return opts, errors.New("Invalid columns list")
+			}
+		}
+	}
+	if value, ok := formValue("encoding"); ok {
+		dialect.Encoding = value
+	}
+	if err := parsers.ValidateCSVDialect(dialect); err != nil {
+		return opts, fmt.Errorf("Invalid CSV dialect: %v", err)
+	}
+
+	if opts.RecordType == "" && len(opts.SheetRecordTypes) == 0 && len(opts.EntryRecordTypes) == 0 {
+		return opts, errors.New("Record type is required")
+	}
+	return opts, nil
+}
+
+// storedParseOptions turns parser settings stored with an upload back into parse options.
+func storedParseOptions(userID string, stored models.UploadOptions) parsers.ParseOptions {
+	opts := parsers.ParseOptions{
+		UserID:           userID,
+		RecordType:       stored.RecordType,
+		Sheet:            stored.Sheet,
+		SheetRecordTypes: stored.SheetRecordTypes,
+		RecordElement:    stored.RecordElement,
+		EntryRecordTypes: stored.EntryRecordTypes,
+		CSVDialect:       stored.CSVDialect,
+	}
+	if len(stored.ColumnTypes) > 0 {
+		opts.ColumnTypes = make(map[string]parsers.ColumnType, len(stored.ColumnTypes))
+		for column, columnType := range stored.ColumnTypes {
+			opts.ColumnTypes[column] = parsers.ColumnType(columnType)
+		}
+	}
+	return opts
 }
@@ -0,0 +1,492 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/vd09-projects/my-documentdb-system/internal/db"
+	"github.com/vd09-projects/my-documentdb-system/internal/jobs"
+	"github.com/vd09-projects/my-documentdb-system/internal/models"
+	"github.com/vd09-projects/my-documentdb-system/internal/parsers"
+	"github.com/vd09-projects/my-documentdb-system/internal/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+)
+
+// uploadSessionTTL is how long an upload session waits for its next chunk before it is deleted.
+const uploadSessionTTL = 24 * time.Hour
+
+// maxChunkDuration bounds the time a single chunk may take to arrive.
+const maxChunkDuration = 30 * time.Minute
+
+// fileDeleteTimeout bounds the deletion of a session's file, which may have many chunks.
+const fileDeleteTimeout = 10 * time.Minute
+
+// uploadSessionLocks holds the sessions a request is writing to, so that the chunks of a
+// session are stored one request at a time.
+var uploadSessionLocks sync.Map
+
+type uploadSessionResponse struct {
+	ID        string    `json:"id"`
+	FileName  string    `json:"fileName"`
+	Length    int64     `json:"length"`
+	Offset    int64     `json:"offset"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// UploadID is the upload ingesting the file once every chunk has arrived.
+	UploadID string `json:"uploadId,omitempty"`
+}
+
+func writeUploadSession(w http.ResponseWriter, status int, session models.UploadSession) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(session.Length, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(uploadSessionResponse{
+		ID:        session.ID.Hex(),
+		FileName:  session.FileName,
+		Length:    session.Length,
+		Offset:    session.Offset,
+		ExpiresAt: session.ExpiresAt,
+		UploadID:  session.UploadID,
+	})
+}
+
+// e.g. POST /upload/sessions?recordType=orders&fileName=orders.csv with an Upload-Length header
+// Starts a resumable upload of Upload-Length bytes. The settings are those of POST /upload, as
+// query parameters or form fields, plus the file's fileName and optional contentType, which
+// must tell its format. Chunks are then sent with PATCH /upload/sessions/{id}.
+func CreateUploadSessionHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	claims, ok := r.Context().Value(UserClaimsKey).(*utils.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := r.ParseMultipartForm(1 << 20); err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		http.Error(w, "Could not parse form", http.StatusBadRequest)
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		http.Error(w, "Upload-Length must be a positive number of bytes", http.StatusBadRequest)
+		return
+	}
+	maxSize := maxUploadSize(claims.Username)
+	if length > maxSize {
+		http.Error(w, uploadTooLargeMessage(maxSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	opts, err := parseOptionsFromForm(r, claims.UserID, models.UploadOptions{})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	idempotencyKey := r.Header.Get("Idempotency-Key")
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		http.Error(w, "Idempotency-Key is too long", http.StatusBadRequest)
+		return
+	}
+
+	// Content sniffing would have to wait for the whole file, so the format is settled up front
+	fileName := r.FormValue("fileName")
+	contentType := r.FormValue("contentType")
+	if _, ok := parsers.DetectByName(fileName, contentType); !ok {
+		http.Error(w, "fileName or contentType must name the file's format. "+parsers.UnsupportedFormatError().Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	session := models.UploadSession{
+		ID:             primitive.NewObjectID(),
+		UserID:         claims.UserID,
+		FileName:       fileName,
+		ContentType:    contentType,
+		Length:         length,
+		HashState:      marshalHash(sha256.New()),
+		Options:        uploadOptions(opts),
+		IdempotencyKey: idempotencyKey,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(uploadSessionTTL),
+	}
+	sessionDB := db.NewUploadSessionDB(db.MongoClient, db.DatabaseName)
+	if err := sessionDB.CreateSession(ctx, session); err != nil {
+		http.Error(w, "Failed to start upload", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", "/upload/sessions/"+session.ID.Hex())
+	writeUploadSession(w, http.StatusCreated, session)
+}
+
+// e.g. GET /upload/sessions/{id}
+// Reports how many bytes have arrived, so that a client can resume from there.
+func GetUploadSessionHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	claims, ok := r.Context().Value(UserClaimsKey).(*utils.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	session, err := getUploadSession(ctx, claims.UserID, r.PathValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if session == nil {
+		http.Error(w, "Upload session not found", http.StatusNotFound)
+		return
+	}
+
+	writeUploadSession(w, http.StatusOK, *session)
+}
+
+// e.g. PATCH /upload/sessions/{id} with an Upload-Offset header and the next bytes of the file
+// Upload-Offset must equal the session's offset. The bytes that arrive are kept even if the
+// connection drops, and the file is queued for ingestion once the last byte is stored; the
+// final chunk is then answered like POST /upload. A completion that failed, e.g. because the
+// upload queue was full, is retried by sending an empty chunk at the final offset.
+func AppendUploadSessionHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), maxChunkDuration)
+	defer cancel()
+
+	claims, ok := r.Context().Value(UserClaimsKey).(*utils.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	unlock, ok := lockUploadSession(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "Another chunk of this upload is being written", http.StatusConflict)
+		return
+	}
+	defer unlock()
+
+	session, err := getUploadSession(ctx, claims.UserID, r.PathValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if session == nil {
+		http.Error(w, "Upload session not found", http.StatusNotFound)
+		return
+	}
+	if session.UploadID != "" {
+		http.Error(w, "Upload is already complete as upload "+session.UploadID, http.StatusConflict)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		http.Error(w, "Upload-Offset is required", http.StatusBadRequest)
+		return
+	}
+	if offset != session.Offset {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+		http.Error(w, fmt.Sprintf("Upload-Offset %d does not match the %d bytes received", offset, session.Offset), http.StatusConflict)
+		return
+	}
+
+	hasher, err := unmarshalHash(session.HashState)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fileDB, err := db.NewFileDB(db.MongoClient, db.DatabaseName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	body := http.MaxBytesReader(w, r.Body, session.Length-session.Offset)
+	written, appendErr := fileDB.AppendChunks(ctx, session.ID, session.Offset, body, hasher)
+	if written > 0 {
+		sessionDB := db.NewUploadSessionDB(db.MongoClient, db.DatabaseName)
+		expiresAt := time.Now().Add(uploadSessionTTL)
+		advanced, err := sessionDB.AdvanceSession(ctx, session.ID, session.Offset, session.Offset+written, marshalHash(hasher), expiresAt)
+		if err != nil {
+			http.Error(w, "Failed to record chunk", http.StatusInternalServerError)
+			return
+		}
+		if !advanced {
+			http.Error(w, "Upload session changed while the chunk was written", http.StatusConflict)
+			return
+		}
+		session.Offset += written
+		session.ExpiresAt = expiresAt
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+
+	if appendErr != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(appendErr, &tooLarge) {
+			http.Error(w, "Chunk runs past the Upload-Length of the upload", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Failed to store chunk: "+appendErr.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if session.Offset < session.Length {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	completeUploadSession(w, claims, *session, fileDB, hex.EncodeToString(hasher.Sum(nil)))
+}
+
+// completeUploadSession turns a session whose chunks have all arrived into a GridFS file and
+// queues its ingestion, answering like POST /upload.
+func completeUploadSession(w http.ResponseWriter, claims *utils.Claims, session models.UploadSession, fileDB *db.FileDB, fileHash string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	job := jobs.NewJob(claims.UserID, session.Options.RecordType, session.FileName)
+	if err := fileDB.FinishChunkedFile(ctx, session.ID, session.FileName, claims.UserID, job.ID(), session.Length); err != nil {
+		http.Error(w, "Failed to store upload", http.StatusInternalServerError)
+		return
+	}
+
+	file, err := fileDB.OpenFile(session.ID)
+	if err != nil {
+		http.Error(w, "Failed to read upload", http.StatusInternalServerError)
+		return
+	}
+	format, _, ok, err := parsers.Detect(session.FileName, session.ContentType, file)
+	file.Close()
+	if err != nil || !ok {
+		if err := discardUploadSession(fileDB, session); err != nil {
+			log.Printf("Failed to discard upload session %s: %v", session.ID.Hex(), err)
+		}
+		if err != nil {
+			http.Error(w, "Could not read uploaded file: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, parsers.UnsupportedFormatError().Error(), http.StatusBadRequest)
+		return
+	}
+
+	opts := storedParseOptions(claims.UserID, session.Options)
+	if err := loadValidationRules(ctx, &opts); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	opts.BatchID = job.ID()
+	opts.FileName = session.FileName
+	opts.UploadedBy = claims.Username
+
+	database := db.NewRecordDB(db.MongoClient, db.DatabaseName)
+	parser := format.New(jobs.TrackProgress(database, job))
+
+	// A rejected job keeps the file so that the completion can be retried
+	existing, err := queueUpload(job, models.Upload{
+		ID:             job.ID(),
+		UserID:         claims.UserID,
+		RecordType:     opts.RecordType,
+		FileName:       session.FileName,
+		FileHash:       fileHash,
+		Format:         format.Name,
+		Compression:    format.Compression,
+		UploadedBy:     claims.Username,
+		FileID:         session.ID,
+		Options:        session.Options,
+		IdempotencyKey: session.IdempotencyKey,
+		DedupeKey:      uploadDedupeKey(session.IdempotencyKey, fileHash, opts),
+		Status:         string(jobs.StatusQueued),
+		CreatedAt:      time.Now(),
+	}, fileDB, parser, opts, nil)
+	if errors.Is(err, jobs.ErrQueueFull) {
+		http.Error(w, "Too many uploads in progress, try again later", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to record upload", http.StatusInternalServerError)
+		return
+	}
+
+	sessionDB := db.NewUploadSessionDB(db.MongoClient, db.DatabaseName)
+	if existing != nil {
+		// A session whose file could not be deleted stays open, so that it expires with its file
+		if err := deleteSessionFile(fileDB, session.ID); err != nil {
+			log.Printf("Failed to delete upload file %s: %v", session.ID.Hex(), err)
+		} else if err := sessionDB.CompleteSession(ctx, session.ID, existing.ID); err != nil {
+			log.Printf("Failed to complete upload session %s: %v", session.ID.Hex(), err)
+		}
+		writeReplayedUpload(w, *existing)
+		return
+	}
+	// The upload is queued either way; a session left open only expires
+	if err := sessionDB.CompleteSession(ctx, session.ID, job.ID()); err != nil {
+		log.Printf("Failed to complete upload session %s: %v", session.ID.Hex(), err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job.Snapshot())
+}
+
+// e.g. DELETE /upload/sessions/{id}
+// Abandons a resumable upload and deletes the chunks received so far. The upload of a
+// completed session is not affected.
+func DeleteUploadSessionHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	claims, ok := r.Context().Value(UserClaimsKey).(*utils.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	unlock, ok := lockUploadSession(r.PathValue("id"))
+	if !ok {
+		http.Error(w, "A chunk of this upload is being written", http.StatusConflict)
+		return
+	}
+	defer unlock()
+
+	session, err := getUploadSession(ctx, claims.UserID, r.PathValue("id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if session == nil {
+		http.Error(w, "Upload session not found", http.StatusNotFound)
+		return
+	}
+
+	fileDB, err := db.NewFileDB(db.MongoClient, db.DatabaseName)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := discardUploadSession(fileDB, *session); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PurgeExpiredUploadSessions deletes abandoned upload sessions and their chunks every interval.
+// It never returns.
+func PurgeExpiredUploadSessions(interval time.Duration) {
+	for range time.Tick(interval) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		if err := purgeExpiredUploadSessions(ctx); err != nil {
+			log.Printf("Failed to purge expired upload sessions: %v", err)
+		}
+		cancel()
+	}
+}
+
+func purgeExpiredUploadSessions(ctx context.Context) error {
+	fileDB, err := db.NewFileDB(db.MongoClient, db.DatabaseName)
+	if err != nil {
+		return err
+	}
+	sessionDB := db.NewUploadSessionDB(db.MongoClient, db.DatabaseName)
+	sessions, err := sessionDB.ListExpiredSessions(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		unlock, ok := lockUploadSession(session.ID.Hex())
+		if !ok {
+			continue
+		}
+		// A session that cannot be discarded now is left for the next sweep
+		if err := discardUploadSession(fileDB, session); err != nil {
+			log.Printf("Failed to discard upload session %s: %v", session.ID.Hex(), err)
+		}
+		unlock()
+	}
+	return nil
+}
+
+// getUploadSession returns a live session of the user, or nil if there is none with that ID.
+func getUploadSession(ctx context.Context, userID, id string) (*models.UploadSession, error) {
+	sessionID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, nil
+	}
+	sessionDB := db.NewUploadSessionDB(db.MongoClient, db.DatabaseName)
+	session, err := sessionDB.GetSession(ctx, userID, sessionID)
+	if err != nil || session == nil {
+		return nil, err
+	}
+	// Expired sessions may not have been swept yet
+	if session.UploadID == "" && time.Now().After(session.ExpiresAt) {
+		return nil, nil
+	}
+	return session, nil
+}
+
+// discardUploadSession deletes a session and, unless an upload took it over, its file. The
+// session is only deleted once its file is, so a failed discard can be retried.
+func discardUploadSession(fileDB *db.FileDB, session models.UploadSession) error {
+	if session.UploadID == "" {
+		if err := deleteSessionFile(fileDB, session.ID); err != nil {
+			return err
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	sessionDB := db.NewUploadSessionDB(db.MongoClient, db.DatabaseName)
+	_, err := sessionDB.DeleteSession(ctx, session.UserID, session.ID)
+	return err
+}
+
+// deleteSessionFile deletes the file of a session, with time enough for a file of many chunks.
+func deleteSessionFile(fileDB *db.FileDB, fileID primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), fileDeleteTimeout)
+	defer cancel()
+	// The file has no files document until it is complete, but its chunks are still deleted
+	if err := fileDB.DeleteFile(ctx, fileID); err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+		return err
+	}
+	return nil
+}
+
+// lockUploadSession claims a session for the calling request. It returns false if another
+// request holds it.
+func lockUploadSession(id string) (unlock func(), ok bool) {
+	if _, busy := uploadSessionLocks.LoadOrStore(id, struct{}{}); busy {
+		return nil, false
+	}
+	return func() { uploadSessionLocks.Delete(id) }, true
+}
+
+// marshalHash saves the state of a running SHA-256 hash.
+func marshalHash(h hash.Hash) []byte {
+	state, _ := h.(encoding.BinaryMarshaler).MarshalBinary()
+	return state
+}
+
+func unmarshalHash(state []byte) (hash.Hash, error) {
+	h := sha256.New()
+	if err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+		return nil, fmt.Errorf("invalid upload session hash state: %w", err)
+	}
+	return h, nil
+}
@@ -0,0 +1,209 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+)
+
+// maxJobErrors caps the number of error messages kept per job.
+const maxJobErrors = 100
+
+// RunFunc performs the work of a job and returns its result, e.g. a parsers.ParseResult.
+type RunFunc func(ctx context.Context, job *Job) (interface{}, error)
+
+// Job tracks one background job, such as an upload, from submission until it finishes.
+type Job struct {
+	mu sync.Mutex
+
+	id         string
+	userID     string
+	recordType string
+	fileName   string
+
+	status        Status
+	rowsProcessed int64
+	inserted      int64
+	quarantined   int64
+	errors        []string
+	result        interface{}
+
+	createdAt  time.Time
+	startedAt  time.Time
+	finishedAt time.Time
+
+	run     RunFunc
+	cleanup func()
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+// Snapshot is the JSON view of a job returned by the API.
+type Snapshot struct {
+	ID            string      `json:"id"`
+	RecordType    string      `json:"recordType"`
+	FileName      string      `json:"fileName,omitempty"`
+	Status        Status      `json:"status"`
+	RowsProcessed int64       `json:"rowsProcessed"`
+	Inserted      int64       `json:"inserted"`
+	Quarantined   int64       `json:"quarantined"`
+	Errors        []string    `json:"errors"`
+	Result        interface{} `json:"result,omitempty"`
+	CreatedAt     time.Time   `json:"createdAt"`
+	StartedAt     *time.Time  `json:"startedAt,omitempty"`
+	FinishedAt    *time.Time  `json:"finishedAt,omitempty"`
+}
+
+func NewJob(userID, recordType, fileName string) *Job {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Job{
+		id:         primitive.NewObjectID().Hex(),
+		userID:     userID,
+		recordType: recordType,
+		fileName:   fileName,
+		status:     StatusQueued,
+		errors:     []string{},
+		createdAt:  time.Now(),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+func (j *Job) ID() string {
+	return j.id
+}
+
+func (j *Job) UserID() string {
+	return j.userID
+}
+
+func (j *Job) Snapshot() Snapshot {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	snap := Snapshot{
+		ID:            j.id,
+		RecordType:    j.recordType,
+		FileName:      j.fileName,
+		Status:        j.status,
+		RowsProcessed: j.rowsProcessed,
+		Inserted:      j.inserted,
+		Quarantined:   j.quarantined,
+		Errors:        append([]string{}, j.errors...),
+		Result:        j.result,
+		CreatedAt:     j.createdAt,
+	}
+	if !j.startedAt.IsZero() {
+		startedAt := j.startedAt
+		snap.StartedAt = &startedAt
+	}
+	if !j.finishedAt.IsZero() {
+		finishedAt := j.finishedAt
+		snap.FinishedAt = &finishedAt
+	}
+	return snap
+}
+
+// AddInserted records rows that were stored in valid_records.
+func (j *Job) AddInserted(n int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.inserted += int64(n)
+	j.rowsProcessed += int64(n)
+}
+
+// AddQuarantined records rows that were stored in quarantine_records.
+func (j *Job) AddQuarantined(n int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.quarantined += int64(n)
+	j.rowsProcessed += int64(n)
+}
+
+func (j *Job) AddError(msg string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if len(j.errors) < maxJobErrors {
+		j.errors = append(j.errors, msg)
+	}
+}
+
+// Finished reports whether the job has completed, failed or been cancelled.
+func (j *Job) Finished() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.finished()
+}
+
+func (j *Job) finished() bool {
+	switch j.status {
+	case StatusCompleted, StatusFailed, StatusCancelled:
+		return true
+	}
+	return false
+}
+
+// start moves a queued job to running. It returns false if the job was cancelled while queued.
+func (j *Job) start() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.status != StatusQueued {
+		return false
+	}
+	j.status = StatusRunning
+	j.startedAt = time.Now()
+	return true
+}
+
+func (j *Job) finish(result interface{}, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.finishedAt = time.Now()
+	j.result = result
+	switch {
+	case j.ctx.Err() != nil:
+		j.status = StatusCancelled
+	case err != nil:
+		j.status = StatusFailed
+		if len(j.errors) < maxJobErrors {
+			j.errors = append(j.errors, err.Error())
+		}
+	default:
+		j.status = StatusCompleted
+	}
+	j.cancel()
+}
+
+func (j *Job) runCleanup() {
+	if j.cleanup != nil {
+		j.cleanup()
+	}
+}
+
+// Cancel stops a queued or running job. It returns false if the job had already finished.
+func (j *Job) Cancel() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.finished() {
+		return false
+	}
+	if j.status == StatusQueued {
+		j.status = StatusCancelled
+		j.finishedAt = time.Now()
+	}
+	j.cancel()
+	return true
+}
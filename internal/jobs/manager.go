@@ -0,0 +1,120 @@
+package jobs
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// UploadQueue runs upload jobs in the background. It is set by StartUploadWorkers.
+var UploadQueue *Manager
+
+// RevalidationQueue runs quarantine re-validation jobs apart from uploads, so a long
+// re-validation does not hold up new uploads. It is set by StartRevalidationWorkers.
+var RevalidationQueue *Manager
+
+// jobRetention is how long finished jobs stay available for status queries.
+const jobRetention = 24 * time.Hour
+
+var ErrQueueFull = errors.New("job queue is full")
+
+// Manager runs jobs on a fixed number of workers fed by a bounded queue.
+type Manager struct {
+	mu    sync.Mutex
+	jobs  map[string]*Job
+	queue chan *Job
+}
+
+// StartUploadWorkers creates UploadQueue with the given number of workers and queue capacity.
+func StartUploadWorkers(workers, queueSize int) {
+	UploadQueue = NewManager(workers, queueSize)
+	log.Printf("Started %d upload workers", workers)
+}
+
+// StartRevalidationWorkers creates RevalidationQueue with the given number of workers and queue capacity.
+func StartRevalidationWorkers(workers, queueSize int) {
+	RevalidationQueue = NewManager(workers, queueSize)
+	log.Printf("Started %d revalidation workers", workers)
+}
+
+func NewManager(workers, queueSize int) *Manager {
+	m := &Manager{
+		jobs:  make(map[string]*Job),
+		queue: make(chan *Job, queueSize),
+	}
+	for i := 0; i < workers; i++ {
+		go m.worker()
+	}
+	return m
+}
+
+// Submit queues a job. cleanup, if not nil, runs once the job is done with, whether it ran,
+// was cancelled while queued or was rejected. It returns ErrQueueFull when every worker is busy
+// and the queue is at capacity.
+func (m *Manager) Submit(job *Job, run RunFunc, cleanup func()) error {
+	job.run = run
+	job.cleanup = cleanup
+
+	m.mu.Lock()
+	m.pruneLocked()
+	m.jobs[job.id] = job
+	m.mu.Unlock()
+
+	select {
+	case m.queue <- job:
+		return nil
+	default:
+		m.mu.Lock()
+		delete(m.jobs, job.id)
+		m.mu.Unlock()
+		job.cancel()
+		job.runCleanup()
+		return ErrQueueFull
+	}
+}
+
+// Get returns the job with the given ID if it belongs to userID.
+func (m *Manager) Get(id, userID string) (*Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok || job.userID != userID {
+		return nil, false
+	}
+	return job, true
+}
+
+func (m *Manager) worker() {
+	for job := range m.queue {
+		if job.start() {
+			result, err := m.runJob(job)
+			job.finish(result, err)
+		}
+		job.runCleanup()
+	}
+}
+
+// runJob runs a job and turns a panic into a job failure so the worker keeps running.
+func (m *Manager) runJob(job *Job) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Job %s panicked: %v", job.id, r)
+			err = errors.New("internal error while running job")
+		}
+	}()
+	return job.run(job.ctx, job)
+}
+
+// pruneLocked drops finished jobs older than jobRetention. m.mu must be held.
+func (m *Manager) pruneLocked() {
+	cutoff := time.Now().Add(-jobRetention)
+	for id, job := range m.jobs {
+		job.mu.Lock()
+		expired := job.finished() && job.finishedAt.Before(cutoff)
+		job.mu.Unlock()
+		if expired {
+			delete(m.jobs, id)
+		}
+	}
+}
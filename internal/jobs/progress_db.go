@@ -0,0 +1,56 @@
+package jobs
+
+import (
+	"context"
+
+	"github.com/vd09-projects/my-documentdb-system/internal/db"
+	"github.com/vd09-projects/my-documentdb-system/internal/models"
+)
+
+// progressDatabase counts the records a parser stores so a running job can report progress.
+type progressDatabase struct {
+	db.Database
+	job *Job
+}
+
+// TrackProgress wraps database so every stored record is counted on job.
+func TrackProgress(database db.Database, job *Job) db.Database {
+	return &progressDatabase{Database: database, job: job}
+}
+
+func (d *progressDatabase) InsertToValid(ctx context.Context, record db.ValidRecord, userID string, recordType string) error {
+	err := d.Database.InsertToValid(ctx, record, userID, recordType)
+	if err != nil {
+		d.addError(ctx, err)
+		return err
+	}
+	d.job.AddInserted(1)
+	return nil
+}
+
+func (d *progressDatabase) InsertManyToValid(ctx context.Context, records []db.ValidRecord, userID string, recordType string) error {
+	err := d.Database.InsertManyToValid(ctx, records, userID, recordType)
+	if err != nil {
+		d.addError(ctx, err)
+		return err
+	}
+	d.job.AddInserted(len(records))
+	return nil
+}
+
+func (d *progressDatabase) InsertToQuarantine(ctx context.Context, data interface{}, userID string, recordType string, recordErr models.RecordError, provenance *models.Provenance) error {
+	err := d.Database.InsertToQuarantine(ctx, data, userID, recordType, recordErr, provenance)
+	if err != nil {
+		d.addError(ctx, err)
+		return err
+	}
+	d.job.AddQuarantined(1)
+	return nil
+}
+
+// addError records a storage error unless it was caused by the job being cancelled.
+func (d *progressDatabase) addError(ctx context.Context, err error) {
+	if ctx.Err() == nil {
+		d.job.AddError(err.Error())
+	}
+}
@@ -0,0 +1,13 @@
+package models
+
+// Provenance records where a stored record came from.
+type Provenance struct {
+	// BatchID is the ID of the upload that stored the record.
+	BatchID  string `bson:"batchID" json:"batchId"`
+	FileName string `bson:"fileName" json:"fileName"`
+	// Entry is the file inside a ZIP upload that held the record.
+	Entry string `bson:"entry,omitempty" json:"entry,omitempty"`
+	// Row is the 1-based position of the record in the file, as reported in upload errors.
+	Row        int    `bson:"row" json:"row"`
+	UploadedBy string `bson:"uploadedBy" json:"uploadedBy"`
+}
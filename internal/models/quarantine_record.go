@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// QuarantineRecord is a record that failed parsing or validation. Data holds what was
+// received, e.g. the original CSV row, until it is edited into a valid record.
+type QuarantineRecord struct {
+	ID         primitive.ObjectID `bson:"_id"`
+	Data       interface{}        `bson:"data"`
+	UserID     string             `bson:"userID"`
+	RecordType string             `bson:"recordType"`
+	// RecordError holds the error code, field and reason of the last failed check
+	RecordError `bson:",inline"`
+	Timestamp   time.Time   `bson:"timestamp"`
+	Provenance  *Provenance `bson:"provenance,omitempty"`
+}
@@ -0,0 +1,30 @@
+package models
+
+// Error codes stored with quarantined records. They identify the check a record failed and
+// stay stable, unlike the human readable reason next to them.
+const (
+	ErrorCSVRead           = "CSV_READ_ERROR"
+	ErrorColumnCount       = "COLUMN_COUNT_MISMATCH"
+	ErrorTypeConversion    = "TYPE_CONVERSION_FAILED"
+	ErrorInvalidJSON       = "INVALID_JSON"
+	ErrorInvalidXML        = "INVALID_XML"
+	ErrorNotObject         = "NOT_AN_OBJECT"
+	ErrorMissingUserID     = "MISSING_USER_ID"
+	ErrorSchemaViolation   = "SCHEMA_VIOLATION"
+	ErrorTransformFailed   = "TRANSFORM_FAILED"
+	ErrorMissingNaturalKey = "MISSING_NATURAL_KEY"
+	ErrorInvalidEventTime  = "INVALID_EVENT_TIME"
+)
+
+// RecordError says why a record was quarantined: a machine readable Code, the field path at
+// fault when there is one, and a Reason for people.
+type RecordError struct {
+	Code   string `bson:"errorCode" json:"code"`
+	Field  string `bson:"field,omitempty" json:"field,omitempty"`
+	Reason string `bson:"reason" json:"reason"`
+}
+
+// NewRecordError returns a RecordError with the given code, field and reason.
+func NewRecordError(code, field, reason string) *RecordError {
+	return &RecordError{Code: code, Field: field, Reason: reason}
+}
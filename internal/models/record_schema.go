@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// RecordSchema is one version of the JSON Schema a user attached to a record type.
+// The schema is kept as raw JSON text because keywords such as "$ref" are not valid BSON keys.
+// A version with Removed set records that the schema was detached; it has no schema text.
+type RecordSchema struct {
+	UserID     string    `bson:"userID"`
+	RecordType string    `bson:"recordType"`
+	Version    int       `bson:"version"`
+	Schema     string    `bson:"schema"`
+	Removed    bool      `bson:"removed,omitempty"`
+	CreatedAt  time.Time `bson:"createdAt"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// RecordTypeConfig holds the per-record-type settings of a user that are not part of the schema.
+type RecordTypeConfig struct {
+	UserID     string `bson:"userID"`
+	RecordType string `bson:"recordType"`
+	// NaturalKey lists the field paths that identify a record, e.g. ["orderId"].
+	// Records with a natural key are upserted instead of inserted.
+	NaturalKey []string `bson:"naturalKey,omitempty"`
+	// Transforms run in order on every parsed record before it is validated.
+	Transforms []Transform `bson:"transforms,omitempty"`
+	// EventTime names the field holding the time a record's event happened, e.g. an order date.
+	EventTime *EventTime `bson:"eventTime,omitempty"`
+	UpdatedAt time.Time  `bson:"updatedAt"`
+}
+
+// EventTime says where a record type keeps its event time and how it is written.
+type EventTime struct {
+	Field string `bson:"field" json:"field"`
+	// Layout is a Go time layout such as "02/01/2006", or "unix" / "unixMillis" for epoch numbers.
+	// The common ISO 8601 forms are recognised when empty.
+	Layout string `bson:"layout,omitempty" json:"layout,omitempty"`
+}
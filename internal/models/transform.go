@@ -0,0 +1,23 @@
+package models
+
+// Transform is one step of the pipeline a record type applies to parsed records before
+// validation. Op selects the step and which of the other fields it reads:
+//
+//	rename:  Field, To
+//	cast:    Field, Type (string, int, float, bool or date)
+//	drop:    Field
+//	default: Field, Value
+//	split:   Field, Separator, Into
+//	concat:  Fields, Separator, To
+//	compute: Field, Expression, e.g. "price * quantity"
+type Transform struct {
+	Op         string      `bson:"op" json:"op"`
+	Field      string      `bson:"field,omitempty" json:"field,omitempty"`
+	Fields     []string    `bson:"fields,omitempty" json:"fields,omitempty"`
+	To         string      `bson:"to,omitempty" json:"to,omitempty"`
+	Into       []string    `bson:"into,omitempty" json:"into,omitempty"`
+	Type       string      `bson:"type,omitempty" json:"type,omitempty"`
+	Value      interface{} `bson:"value,omitempty" json:"value,omitempty"`
+	Separator  string      `bson:"separator,omitempty" json:"separator,omitempty"`
+	Expression string      `bson:"expression,omitempty" json:"expression,omitempty"`
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Upload records a submitted upload, the batch its records are stamped with. It lets retries
+// of the same upload be recognised and a batch be rolled back.
+type Upload struct {
+	// ID is the ID of the job that processes the upload.
+	ID         string `bson:"_id"`
+	UserID     string `bson:"userID"`
+	RecordType string `bson:"recordType"`
+	FileName   string `bson:"fileName"`
+	FileHash   string `bson:"fileHash"` // hex SHA-256 of the file
+	// Format is the name of the parser format the file was read as, e.g. "csv"
+	Format string `bson:"format,omitempty"`
+	// Compression is "gzip" or "zstd" for a compressed file, which is stored compressed
+	Compression string `bson:"compression,omitempty"`
+	UploadedBy  string `bson:"uploadedBy"`
+	// FileID is the GridFS ID of the stored file.
+	FileID         primitive.ObjectID `bson:"fileID,omitempty"`
+	Options        UploadOptions      `bson:"options"`
+	IdempotencyKey string             `bson:"idempotencyKey,omitempty"`
+	// DedupeKey identifies repeats of this upload: the Idempotency-Key header when given,
+	// otherwise the file hash plus the record types written. It is cleared when the upload
+	// fails so that it can be retried.
+	DedupeKey   string     `bson:"dedupeKey,omitempty"`
+	Status      string     `bson:"status"`
+	Inserted    int64      `bson:"inserted"`
+	Quarantined int64      `bson:"quarantined"`
+	CreatedAt   time.Time  `bson:"createdAt"`
+	FinishedAt  *time.Time `bson:"finishedAt,omitempty"`
+	// RolledBackAt is set once the records of the upload have been removed.
+	RolledBackAt *time.Time `bson:"rolledBackAt,omitempty"`
+	// Replaces and ReplacedBy link a re-ingested upload with the upload whose records it replaced.
+	Replaces   string `bson:"replaces,omitempty"`
+	ReplacedBy string `bson:"replacedBy,omitempty"`
+	// ReplacingBy is the re-ingestion that has claimed the upload while it runs.
+	ReplacingBy string `bson:"replacingBy,omitempty"`
+}
+
+// UploadOptions are the parser settings an upload was submitted with, kept for re-ingestion.
+type UploadOptions struct {
+	RecordType       string            `bson:"recordType"`
+	Sheet            string            `bson:"sheet,omitempty"`
+	SheetRecordTypes map[string]string `bson:"sheetRecordTypes,omitempty"`
+	RecordElement    string            `bson:"recordElement,omitempty"`
+	ColumnTypes      map[string]string `bson:"columnTypes,omitempty"`
+	EntryRecordTypes map[string]string `bson:"entryRecordTypes,omitempty"`
+	CSVDialect       CSVDialect        `bson:"csvDialect,omitempty"`
+}
+
+// CSVDialect describes how a CSV file is written when it is not comma separated UTF-8 with
+// a header on the first line. The zero value is that default.
+type CSVDialect struct {
+	// Delimiter is the single character between cells, e.g. "\t" or ";".
+	Delimiter string `bson:"delimiter,omitempty" json:"delimiter,omitempty"`
+	// LazyQuotes accepts quotes inside unquoted cells and stray quotes in quoted ones.
+	LazyQuotes bool `bson:"lazyQuotes,omitempty" json:"lazyQuotes,omitempty"`
+	// Comment is a character that marks a line to ignore when it starts it, e.g. "#".
+	Comment string `bson:"comment,omitempty" json:"comment,omitempty"`
+	// SkipRows is the number of lines before the header, such as a report title, to ignore.
+	SkipRows int `bson:"skipRows,omitempty" json:"skipRows,omitempty"`
+	// Columns names the columns of a file without a header line.
+	Columns []string `bson:"columns,omitempty" json:"columns,omitempty"`
+	// Encoding is the character encoding of the file, e.g. "utf-16" or "windows-1252".
+	// A byte order mark, when present, takes precedence.
+	Encoding string `bson:"encoding,omitempty" json:"encoding,omitempty"`
+}
+
+// IsZero reports whether d is the default dialect, so that uploads without one store none.
+func (d CSVDialect) IsZero() bool {
+	return d.Delimiter == "" && !d.LazyQuotes && d.Comment == "" && d.SkipRows == 0 &&
+		len(d.Columns) == 0 && d.Encoding == ""
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// UploadSession is a resumable upload in progress. Its file is written to GridFS a chunk at a
+// time and is ingested like any other upload once all Length bytes have arrived.
+type UploadSession struct {
+	// ID is also the GridFS ID of the file being written.
+	ID          primitive.ObjectID `bson:"_id"`
+	UserID      string             `bson:"userID"`
+	FileName    string             `bson:"fileName"`
+	ContentType string             `bson:"contentType,omitempty"`
+	Length      int64              `bson:"length"`
+	// Offset is the number of bytes received so far.
+	Offset int64 `bson:"offset"`
+	// HashState is the SHA-256 state of the bytes received so far, so the file hash is known
+	// once the last chunk arrives without reading the file again.
+	HashState      []byte        `bson:"hashState"`
+	Options        UploadOptions `bson:"options"`
+	IdempotencyKey string        `bson:"idempotencyKey,omitempty"`
+	// UploadID is set once the file is complete and its upload has been queued.
+	UploadID  string    `bson:"uploadID,omitempty"`
+	CreatedAt time.Time `bson:"createdAt"`
+	// ExpiresAt is pushed back by every chunk; expired sessions are deleted with their chunks.
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
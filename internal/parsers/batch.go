@@ -0,0 +1,55 @@
+package parsers
+
+import (
+	"context"
+
+	"github.com/vd09-projects/my-documentdb-system/internal/db"
+)
+
+// BatchSize is the number of valid records written per bulk insert.
+// It can be overridden at startup, e.g. from the UPLOAD_BATCH_SIZE environment variable.
+var BatchSize = 500
+
+// recordBatch buffers valid records of one record type and writes them with InsertManyToValid.
+type recordBatch struct {
+	ctx        context.Context
+	database   db.Database
+	userID     string
+	recordType string
+	records    []db.ValidRecord
+}
+
+func newRecordBatch(ctx context.Context, database db.Database, userID string, recordType string) *recordBatch {
+	return &recordBatch{
+		ctx:        ctx,
+		database:   database,
+		userID:     userID,
+		recordType: recordType,
+	}
+}
+
+// Add queues a record and flushes the batch once it is full.
+func (b *recordBatch) Add(record db.ValidRecord) error {
+	b.records = append(b.records, record)
+	if len(b.records) >= batchSize() {
+		return b.Flush()
+	}
+	return nil
+}
+
+// Flush writes the queued records. It must be called once parsing is done.
+func (b *recordBatch) Flush() error {
+	if len(b.records) == 0 {
+		return nil
+	}
+	err := b.database.InsertManyToValid(b.ctx, b.records, b.userID, b.recordType)
+	b.records = nil
+	return err
+}
+
+func batchSize() int {
+	if BatchSize < 1 {
+		return 1
+	}
+	return BatchSize
+}
@@ -0,0 +1,161 @@
+package parsers
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vd09-projects/my-documentdb-system/internal/utils"
+)
+
+// ColumnType is the BSON type a text column is converted to before storage.
+type ColumnType string
+
+const (
+	ColumnString ColumnType = "string"
+	ColumnInt    ColumnType = "int"
+	ColumnFloat  ColumnType = "float"
+	ColumnBool   ColumnType = "bool"
+	ColumnDate   ColumnType = "date"
+)
+
+// typeInferenceSampleSize is the number of rows inspected before column types are fixed.
+const typeInferenceSampleSize = 100
+
+func (t ColumnType) valid() bool {
+	switch t {
+	case ColumnString, ColumnInt, ColumnFloat, ColumnBool, ColumnDate:
+		return true
+	}
+	return false
+}
+
+// validateColumnTypes checks an explicit column type map supplied with an upload.
+func validateColumnTypes(columnTypes map[string]ColumnType) error {
+	for column, t := range columnTypes {
+		if !t.valid() {
+			return fmt.Errorf("unsupported type %q for column %q", t, column)
+		}
+	}
+	return nil
+}
+
+// inferColumnTypes picks the narrowest type that every non-empty sample value of a column
+// converts to. Explicit types take precedence over inferred ones. Rows after the sample may
+// still hold values of a wider type; see convertInferredCell.
+func inferColumnTypes(headers []string, sample [][]string, explicit map[string]ColumnType) []ColumnType {
+	types := make([]ColumnType, len(headers))
+	for i, header := range headers {
+		if t, ok := explicit[header]; ok {
+			types[i] = t
+			continue
+		}
+
+		candidates := []ColumnType{ColumnInt, ColumnFloat, ColumnBool, ColumnDate}
+		seen := false
+		for _, row := range sample {
+			if i >= len(row) || row[i] == "" {
+				continue
+			}
+			seen = true
+			remaining := candidates[:0]
+			for _, t := range candidates {
+				if _, err := convertCell(row[i], t); err == nil {
+					remaining = append(remaining, t)
+				}
+			}
+			candidates = remaining
+			if len(candidates) == 0 {
+				break
+			}
+		}
+
+		types[i] = ColumnString
+		if seen && len(candidates) > 0 {
+			types[i] = candidates[0]
+		}
+	}
+	return types
+}
+
+// convertCell converts a text value to the given column type. Empty values become null.
+func convertCell(value string, t ColumnType) (interface{}, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	switch t {
+	case ColumnInt:
+		// Leading zeros are significant in codes such as ZIPs, so keep those as text
+		if hasLeadingZero(value) {
+			return nil, fmt.Errorf("invalid int value %q", value)
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid int value %q", value)
+		}
+		return n, nil
+	case ColumnFloat:
+		if hasLeadingZero(value) {
+			return nil, fmt.Errorf("invalid float value %q", value)
+		}
+		f, err := parseFloatText(value)
+		if err != nil {
+			return nil, err
+		}
+		return f, nil
+	case ColumnBool:
+		switch strings.ToLower(value) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return nil, fmt.Errorf("invalid bool value %q", value)
+	case ColumnDate:
+		for _, layout := range utils.DateLayouts {
+			if d, err := time.Parse(layout, value); err == nil {
+				return d, nil
+			}
+		}
+		return nil, fmt.Errorf("invalid date value %q", value)
+	}
+	return value, nil
+}
+
+// convertInferredCell converts a value to a type inferred from the sample. A value that does
+// not fit is widened instead of rejected, from int to float and from any type to the text
+// itself, since the sample only said what the earlier rows looked like.
+func convertInferredCell(value string, t ColumnType) interface{} {
+	for {
+		if v, err := convertCell(value, t); err == nil {
+			return v
+		}
+		if t == ColumnInt {
+			t = ColumnFloat
+		} else {
+			t = ColumnString
+		}
+	}
+}
+
+// parseFloatText parses a decimal number. NaN, infinities and hex floats are rejected, as
+// they are more likely text than data and cannot be encoded as JSON.
+func parseFloatText(value string) (float64, error) {
+	if strings.ContainsAny(value, "xX") {
+		return 0, fmt.Errorf("invalid float value %q", value)
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("invalid float value %q", value)
+	}
+	return f, nil
+}
+
+// hasLeadingZero reports whether a number is written with a leading zero, e.g. "007".
+func hasLeadingZero(value string) bool {
+	digits := strings.TrimLeft(value, "+-")
+	return len(digits) > 1 && digits[0] == '0' && digits[1] != '.'
+}
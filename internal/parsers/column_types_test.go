@@ -0,0 +1,118 @@
+package parsers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vd09-projects/my-documentdb-system/internal/models"
+)
+
+func TestInferColumnTypes(t *testing.T) {
+	headers := []string{"id", "price", "active", "day", "zip", "note", "mixed", "empty", "forced", "nan", "hex"}
+	sample := [][]string{
+		{"1", "2.5", "true", "2024-01-02", "02134", "a", "1", "", "7", "NaN", "0x1p3"},
+		{"2", "3", "FALSE", "2024-01-03T10:00:00Z", "10001", "b", "x", "", "8", "Inf", "1"},
+		{"-3", "", "true", "", "", "", "2", "", "9", "1.5", "2"},
+		// Short rows leave the missing columns out of the sample
+		{"4"},
+	}
+	explicit := map[string]ColumnType{"forced": ColumnString}
+
+	got := inferColumnTypes(headers, sample, explicit)
+	want := []ColumnType{ColumnInt, ColumnFloat, ColumnBool, ColumnDate, ColumnString, ColumnString, ColumnString, ColumnString, ColumnString, ColumnString, ColumnString}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("inferColumnTypes = %v, want %v", got, want)
+	}
+}
+
+func TestConvertCell(t *testing.T) {
+	tests := []struct {
+		value   string
+		t       ColumnType
+		want    interface{}
+		wantErr bool
+	}{
+		{value: "", t: ColumnInt, want: nil},
+		{value: "42", t: ColumnInt, want: int64(42)},
+		{value: "-7", t: ColumnInt, want: int64(-7)},
+		{value: "007", t: ColumnInt, wantErr: true},
+		{value: "0", t: ColumnInt, want: int64(0)},
+		{value: "1.5", t: ColumnInt, wantErr: true},
+		{value: "0.25", t: ColumnFloat, want: 0.25},
+		{value: "1e3", t: ColumnFloat, want: 1000.0},
+		{value: "01.5", t: ColumnFloat, wantErr: true},
+		{value: "NaN", t: ColumnFloat, wantErr: true},
+		{value: "-Infinity", t: ColumnFloat, wantErr: true},
+		{value: "1e400", t: ColumnFloat, wantErr: true},
+		{value: "0x1p-2", t: ColumnFloat, wantErr: true},
+		{value: "-0X10", t: ColumnFloat, wantErr: true},
+		{value: "True", t: ColumnBool, want: true},
+		{value: "yes", t: ColumnBool, wantErr: true},
+		{value: "2024-01-02", t: ColumnDate, want: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{value: "2024-01-02 03:04:05", t: ColumnDate, want: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{value: "02/01/2024", t: ColumnDate, wantErr: true},
+		{value: "007", t: ColumnString, want: "007"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.t)+" "+tt.value, func(t *testing.T) {
+			got, err := convertCell(tt.value, tt.t)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("convertCell(%q, %s) = %#v, want an error", tt.value, tt.t, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("convertCell(%q, %s): %v", tt.value, tt.t, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("convertCell(%q, %s) = %#v, want %#v", tt.value, tt.t, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertInferredCell(t *testing.T) {
+	tests := []struct {
+		value string
+		t     ColumnType
+		want  interface{}
+	}{
+		{value: "", t: ColumnInt, want: nil},
+		{value: "42", t: ColumnInt, want: int64(42)},
+		{value: "1.5", t: ColumnInt, want: 1.5},
+		{value: "99999999999999999999", t: ColumnInt, want: 1e20},
+		{value: "007", t: ColumnInt, want: "007"},
+		{value: "n/a", t: ColumnInt, want: "n/a"},
+		{value: "NaN", t: ColumnFloat, want: "NaN"},
+		{value: "yes", t: ColumnBool, want: "yes"},
+		{value: "02/01/2024", t: ColumnDate, want: "02/01/2024"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.t)+" "+tt.value, func(t *testing.T) {
+			if got := convertInferredCell(tt.value, tt.t); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("convertInferredCell(%q, %s) = %#v, want %#v", tt.value, tt.t, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMapRowToKeyValue(t *testing.T) {
+	headers := []string{"id", "qty"}
+	types := []ColumnType{ColumnInt, ColumnInt}
+
+	// Only the explicitly typed column rejects a value that does not fit
+	got, recordErr := mapRowToKeyValue(headers, []string{"x1", "2"}, types, map[string]ColumnType{"qty": ColumnInt})
+	if recordErr != nil {
+		t.Fatalf("inferred column rejected a wider value: %+v", recordErr)
+	}
+	if want := map[string]interface{}{"id": "x1", "qty": int64(2)}; !reflect.DeepEqual(got, want) {
+		t.Errorf("mapRowToKeyValue = %#v, want %#v", got, want)
+	}
+
+	_, recordErr = mapRowToKeyValue(headers, []string{"1", "many"}, types, map[string]ColumnType{"qty": ColumnInt})
+	if recordErr == nil || recordErr.Code != models.ErrorTypeConversion || recordErr.Field != "qty" {
+		t.Errorf("explicit column error = %+v, want TYPE_CONVERSION_FAILED on qty", recordErr)
+	}
+}
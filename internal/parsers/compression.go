@@ -0,0 +1,185 @@
+package parsers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/vd09-projects/my-documentdb-system/internal/db"
+)
+
+// compression is a stream compression a single uploaded file may be wrapped in.
+type compression struct {
+	name       string
+	mimeTypes  []string
+	extensions []string
+	magic      []byte
+	newReader  func(r io.Reader) (io.ReadCloser, error)
+}
+
+var compressions = []compression{
+	{
+		name:       "gzip",
+		mimeTypes:  []string{"application/gzip", "application/x-gzip"},
+		extensions: []string{".gz", ".gzip"},
+		magic:      []byte{0x1f, 0x8b},
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+	},
+	{
+		name:       "zstd",
+		mimeTypes:  []string{"application/zstd"},
+		extensions: []string{".zst", ".zstd"},
+		magic:      []byte{0x28, 0xb5, 0x2f, 0xfd},
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			// A single decoder goroutine reads no further ahead than it has to
+			d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				return nil, err
+			}
+			return d.IOReadCloser(), nil
+		},
+	},
+}
+
+func compressionByName(name string) (compression, bool) {
+	for _, c := range compressions {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return compression{}, false
+}
+
+// detectCompression recognises a compressed file by extension, then content type, then magic number.
+// It also returns the file name without the compression extension, e.g. "orders.csv" for "orders.csv.gz".
+func detectCompression(fileName, contentType string, head []byte) (compression, string, bool) {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	for _, c := range compressions {
+		for _, e := range c.extensions {
+			if e == ext {
+				return c, strings.TrimSuffix(fileName, filepath.Ext(fileName)), true
+			}
+		}
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		for _, c := range compressions {
+			for _, m := range c.mimeTypes {
+				if m == mediaType {
+					return c, fileName, true
+				}
+			}
+		}
+	}
+	for _, c := range compressions {
+		if bytes.HasPrefix(head, c.magic) {
+			return c, fileName, true
+		}
+	}
+	return compression{}, "", false
+}
+
+// peek decompresses the first SniffLength bytes of r. The returned reader still yields the
+// whole file as received, compressed.
+func (c compression) peek(r io.Reader) ([]byte, io.Reader, error) {
+	var consumed bytes.Buffer
+	decompressed, err := c.newReader(io.TeeReader(r, &consumed))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid %s file: %w", c.name, err)
+	}
+	defer decompressed.Close()
+
+	head := make([]byte, SniffLength)
+	n, err := io.ReadFull(decompressed, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, nil, fmt.Errorf("invalid %s file: %w", c.name, err)
+	}
+	return head[:n], io.MultiReader(&consumed, r), nil
+}
+
+// wrap returns format reading files compressed with c.
+func (c compression) wrap(format Format) Format {
+	inner := format.New
+	format.Compression = c.name
+	format.New = func(database db.Database) Parser {
+		return &decompressingParser{compression: c, parser: inner(database)}
+	}
+	return format
+}
+
+// decompressingParser decompresses a file as a stream while another parser reads it.
+type decompressingParser struct {
+	compression compression
+	parser      Parser
+}
+
+func (p *decompressingParser) Parse(ctx context.Context, file io.Reader, opts ParseOptions) (*ParseResult, error) {
+	decompressed, err := p.compression.newReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s file: %w", p.compression.name, err)
+	}
+	defer decompressed.Close()
+	return p.parser.Parse(ctx, decompressed, opts)
+}
+
+// Detect picks the format of an upload like DetectFormat, reading the start of file to do so.
+// A gzip or zstd compressed file is recognised by the format it holds; the returned format
+// then decompresses the file while parsing it and names the compression in Compression.
+// The returned reader yields the whole file as received. ok is false when no format matches.
+func Detect(fileName, contentType string, file io.Reader) (format Format, content io.Reader, ok bool, err error) {
+	head, content, err := Peek(file)
+	if err != nil {
+		return Format{}, nil, false, err
+	}
+
+	c, innerName, compressed := detectCompression(fileName, contentType, head)
+	if !compressed {
+		format, ok = DetectFormat(fileName, contentType, head)
+		return format, content, ok, nil
+	}
+
+	innerHead, content, err := c.peek(content)
+	if err != nil {
+		return Format{}, nil, false, err
+	}
+	format, ok = DetectFormat(innerName, "", innerHead)
+	if !ok || format.Name == zipFormat {
+		return Format{}, content, false, nil
+	}
+	return c.wrap(format), content, true, nil
+}
+
+// DetectByName picks the format of a file from its name and content type alone, as Detect
+// would, for when its content has not arrived yet.
+func DetectByName(fileName, contentType string) (Format, bool) {
+	c, innerName, compressed := detectCompression(fileName, contentType, nil)
+	if !compressed {
+		return DetectFormat(fileName, contentType, nil)
+	}
+	format, ok := DetectFormat(innerName, "", nil)
+	if !ok || format.Name == zipFormat {
+		return Format{}, false
+	}
+	return c.wrap(format), true
+}
+
+// FormatByNames returns a registered format as Detect returned it: compression is the
+// Compression of that format, empty for an uncompressed file.
+func FormatByNames(name, compression string) (Format, bool) {
+	format, ok := FormatByName(name)
+	if !ok || compression == "" {
+		return format, ok
+	}
+	c, ok := compressionByName(compression)
+	if !ok {
+		return Format{}, false
+	}
+	return c.wrap(format), true
+}
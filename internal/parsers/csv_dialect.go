@@ -0,0 +1,119 @@
+package parsers
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/vd09-projects/my-documentdb-system/internal/models"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// maxSkipRows bounds CSVDialect.SkipRows.
+const maxSkipRows = 1000
+
+// csvDelimiterNames are the names a delimiter can be given by besides the character itself.
+var csvDelimiterNames = map[string]string{
+	"comma":     ",",
+	"tab":       "\t",
+	"semicolon": ";",
+	"pipe":      "|",
+}
+
+// csvEncodings are the supported source encodings of CSV files. Plain UTF-16 is little endian
+// unless the file starts with a byte order mark.
+var csvEncodings = map[string]encoding.Encoding{
+	"utf-8":        encoding.Nop,
+	"utf8":         encoding.Nop,
+	"utf-16":       unicode.UTF16(unicode.LittleEndian, unicode.UseBOM),
+	"utf-16le":     unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM),
+	"utf-16be":     unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM),
+	"windows-1252": charmap.Windows1252,
+	"cp1252":       charmap.Windows1252,
+	"windows-1250": charmap.Windows1250,
+	"cp1250":       charmap.Windows1250,
+	"iso-8859-1":   charmap.ISO8859_1,
+	"latin1":       charmap.ISO8859_1,
+	"iso-8859-15":  charmap.ISO8859_15,
+	"latin9":       charmap.ISO8859_15,
+}
+
+// ValidateCSVDialect checks a CSV dialect and normalises it: delimiter names such as "tab"
+// become the character and the encoding name is lower-cased.
+func ValidateCSVDialect(d *models.CSVDialect) error {
+	if name, ok := csvDelimiterNames[strings.ToLower(d.Delimiter)]; ok {
+		d.Delimiter = name
+	}
+	if d.Delimiter != "" {
+		if err := checkCSVRune("delimiter", d.Delimiter); err != nil {
+			return err
+		}
+	}
+	if d.Comment != "" {
+		if err := checkCSVRune("comment", d.Comment); err != nil {
+			return err
+		}
+		if d.Comment == d.Delimiter || (d.Delimiter == "" && d.Comment == ",") {
+			return fmt.Errorf("comment and delimiter must differ")
+		}
+	}
+	if d.SkipRows < 0 || d.SkipRows > maxSkipRows {
+		return fmt.Errorf("skipRows must be between 0 and %d", maxSkipRows)
+	}
+	for _, column := range d.Columns {
+		if column == "" {
+			return fmt.Errorf("column names must not be empty")
+		}
+	}
+	d.Encoding = strings.ToLower(strings.TrimSpace(d.Encoding))
+	if _, ok := csvEncodings[d.Encoding]; d.Encoding != "" && !ok {
+		return fmt.Errorf("unsupported encoding %q", d.Encoding)
+	}
+	return nil
+}
+
+func checkCSVRune(name, value string) error {
+	r, size := utf8.DecodeRuneInString(value)
+	if size != len(value) || r == utf8.RuneError || r == '"' || r == '\r' || r == '\n' {
+		return fmt.Errorf("%s must be a single character other than a quote or line break", name)
+	}
+	return nil
+}
+
+// newCSVReader decodes a CSV file to UTF-8, skips its leading lines and sets up a reader for
+// the dialect. A byte order mark is dropped, and switches the encoding to the one it marks.
+func newCSVReader(file io.Reader, d models.CSVDialect) (*csv.Reader, error) {
+	if err := ValidateCSVDialect(&d); err != nil {
+		return nil, err
+	}
+	enc := encoding.Nop
+	if d.Encoding != "" {
+		enc = csvEncodings[d.Encoding]
+	}
+	buffered := bufio.NewReader(transform.NewReader(file, unicode.BOMOverride(enc.NewDecoder())))
+
+	for i := 0; i < d.SkipRows; i++ {
+		if _, err := buffered.ReadString('\n'); err != nil {
+			if err == io.EOF {
+				return nil, fmt.Errorf("file has fewer than %d rows to skip", d.SkipRows)
+			}
+			return nil, err
+		}
+	}
+
+	reader := csv.NewReader(buffered)
+	reader.LazyQuotes = d.LazyQuotes
+	if d.Delimiter != "" {
+		reader.Comma, _ = utf8.DecodeRuneInString(d.Delimiter)
+	}
+	if d.Comment != "" {
+		reader.Comment, _ = utf8.DecodeRuneInString(d.Comment)
+	}
+	return reader, nil
+}
@@ -0,0 +1,151 @@
+package parsers
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/vd09-projects/my-documentdb-system/internal/models"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func TestValidateCSVDialect(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect models.CSVDialect
+		want    models.CSVDialect
+		wantErr bool
+	}{
+		{name: "default", dialect: models.CSVDialect{}, want: models.CSVDialect{}},
+		{name: "named delimiter", dialect: models.CSVDialect{Delimiter: "Tab"}, want: models.CSVDialect{Delimiter: "\t"}},
+		{name: "character delimiter", dialect: models.CSVDialect{Delimiter: ";"}, want: models.CSVDialect{Delimiter: ";"}},
+		{name: "multi-byte delimiter", dialect: models.CSVDialect{Delimiter: "§"}, want: models.CSVDialect{Delimiter: "§"}},
+		{name: "encoding is lower-cased", dialect: models.CSVDialect{Encoding: " Windows-1252 "}, want: models.CSVDialect{Encoding: "windows-1252"}},
+		{name: "two character delimiter", dialect: models.CSVDialect{Delimiter: ";;"}, wantErr: true},
+		{name: "quote delimiter", dialect: models.CSVDialect{Delimiter: `"`}, wantErr: true},
+		{name: "newline comment", dialect: models.CSVDialect{Comment: "\n"}, wantErr: true},
+		{name: "comment equals default delimiter", dialect: models.CSVDialect{Comment: ","}, wantErr: true},
+		{name: "comment equals delimiter", dialect: models.CSVDialect{Delimiter: "pipe", Comment: "|"}, wantErr: true},
+		{name: "negative skipRows", dialect: models.CSVDialect{SkipRows: -1}, wantErr: true},
+		{name: "too many skipRows", dialect: models.CSVDialect{SkipRows: maxSkipRows + 1}, wantErr: true},
+		{name: "empty column name", dialect: models.CSVDialect{Columns: []string{"a", ""}}, wantErr: true},
+		{name: "unknown encoding", dialect: models.CSVDialect{Encoding: "ebcdic"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := tt.dialect
+			err := ValidateCSVDialect(&d)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ValidateCSVDialect(%+v) succeeded, want an error", tt.dialect)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ValidateCSVDialect(%+v): %v", tt.dialect, err)
+			}
+			if !reflect.DeepEqual(d, tt.want) {
+				t.Errorf("ValidateCSVDialect normalised to %+v, want %+v", d, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewCSVReader(t *testing.T) {
+	utf16LE, err := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewEncoder().String("name;city\nJosé;Zürich\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utf16BE, err := unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM).NewEncoder().String("name,city\nJosé,Zürich\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	latin1, err := charmap.Windows1252.NewEncoder().String("name,city\nJosé,Zürich\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		dialect models.CSVDialect
+		want    [][]string
+		wantErr bool
+	}{
+		{
+			name:  "default dialect drops a utf-8 bom",
+			input: "\xef\xbb\xbfname,city\nJosé,Zürich\n",
+			want:  [][]string{{"name", "city"}, {"José", "Zürich"}},
+		},
+		{
+			name:    "utf-16 with bom",
+			input:   utf16LE,
+			dialect: models.CSVDialect{Delimiter: "semicolon", Encoding: "utf-16"},
+			want:    [][]string{{"name", "city"}, {"José", "Zürich"}},
+		},
+		{
+			name:    "utf-16 big endian",
+			input:   utf16BE,
+			dialect: models.CSVDialect{Encoding: "utf-16be"},
+			want:    [][]string{{"name", "city"}, {"José", "Zürich"}},
+		},
+		{
+			name:    "bom overrides the declared encoding",
+			input:   utf16LE,
+			dialect: models.CSVDialect{Delimiter: ";", Encoding: "windows-1252"},
+			want:    [][]string{{"name", "city"}, {"José", "Zürich"}},
+		},
+		{
+			name:    "windows-1252",
+			input:   latin1,
+			dialect: models.CSVDialect{Encoding: "cp1252"},
+			want:    [][]string{{"name", "city"}, {"José", "Zürich"}},
+		},
+		{
+			name:    "skipped rows, tabs and comments",
+			input:   "Monthly report\nGenerated today\nname\tcity\n# a comment\nAna\tOslo\n",
+			dialect: models.CSVDialect{Delimiter: "tab", Comment: "#", SkipRows: 2},
+			want:    [][]string{{"name", "city"}, {"Ana", "Oslo"}},
+		},
+		{
+			name:    "lazy quotes",
+			input:   "name,note\nAna,say \"hi\"\n",
+			dialect: models.CSVDialect{LazyQuotes: true},
+			want:    [][]string{{"name", "note"}, {"Ana", `say "hi"`}},
+		},
+		{
+			name:    "fewer rows than skipRows",
+			input:   "title\n",
+			dialect: models.CSVDialect{SkipRows: 3},
+			wantErr: true,
+		},
+		{
+			name:    "invalid dialect",
+			input:   "a,b\n",
+			dialect: models.CSVDialect{Encoding: "klingon"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, err := newCSVReader(bytes.NewReader([]byte(tt.input)), tt.dialect)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("newCSVReader succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("newCSVReader: %v", err)
+			}
+			got, err := reader.ReadAll()
+			if err != nil {
+				t.Fatalf("ReadAll: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("records = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
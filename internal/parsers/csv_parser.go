@@ -1,68 +1,204 @@
 package parsers
 
 import (
-	"bufio"
+	"bytes"
 	"context"
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"io"
-	"net/http"
+	"unicode/utf8"
 
 	"github.com/vd09-projects/my-documentdb-system/internal/db"
+	"github.com/vd09-projects/my-documentdb-system/internal/models"
 	"github.com/vd09-projects/my-documentdb-system/internal/utils"
 )
 
+var errCSVUnreadable = errors.New("failed to read CSV file")
+
+// CSVParser reads delimited text files. ParseOptions.CSVDialect describes files that are not
+// comma separated UTF-8 with a header on the first line.
 type CSVParser struct {
 	database db.Database
 }
 
-func (p *CSVParser) Parse(ctx context.Context, file io.Reader, w http.ResponseWriter, userID string, recordType string) {
-	fmt.Println("Parse in CSVParser")
-	reader := csv.NewReader(bufio.NewReader(file))
-	headers, err := reader.Read()
-	if err != nil {
-		http.Error(w, "Failed to read CSV headers", http.StatusBadRequest)
-		return
+func init() {
+	Register(Format{
+		Name:       "csv",
+		MIMETypes:  []string{"text/csv", "application/csv", "text/comma-separated-values"},
+		Extensions: []string{".csv"},
+		Sniff:      sniffCSV,
+		New: func(database db.Database) Parser {
+			return &CSVParser{database: database}
+		},
+	})
+}
+
+// sniffCSV recognises text whose first line has several columns separated by a comma,
+// semicolon, tab or pipe.
+func sniffCSV(head []byte) bool {
+	head = trimHead(head)
+	if len(head) == 0 || bytes.IndexByte(head, 0) >= 0 || bytes.IndexByte([]byte("{[<"), head[0]) >= 0 {
+		return false
 	}
+	line, _, _ := bytes.Cut(head, []byte("\n"))
+	return utf8.Valid(line) && bytes.ContainsAny(line, ",;\t|")
+}
 
-	var insertCount, quarantineCount int
+func (p *CSVParser) Parse(ctx context.Context, file io.Reader, opts ParseOptions) (*ParseResult, error) {
+	if err := validateColumnTypes(opts.ColumnTypes); err != nil {
+		return nil, err
+	}
 
-	for {
+	dialect := opts.CSVDialect
+	reader, err := newCSVReader(file, dialect)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV file: %w", err)
+	}
+
+	// read returns the next record and the line it starts on, counting skipped lines. Malformed
+	// rows come back with a csv.ParseError; any other error means the file cannot be read further.
+	read := func() ([]string, int, error) {
 		record, err := reader.Read()
-		if err == io.EOF {
-			break
+		line := 0
+		var parseErr *csv.ParseError
+		if len(record) > 0 {
+			line, _ = reader.FieldPos(0)
+		} else if errors.As(err, &parseErr) {
+			line = parseErr.StartLine
+		} else if err != nil && err != io.EOF {
+			return nil, 0, fmt.Errorf("%w: %w", errCSVUnreadable, err)
 		}
+		return record, line + dialect.SkipRows, err
+	}
+
+	headers := dialect.Columns
+	if len(headers) == 0 {
+		headers, _, err = read()
 		if err != nil {
-			p.database.InsertToQuarantine(ctx, record, userID, recordType, "Error reading CSV")
-			quarantineCount++
-			continue
+			return nil, fmt.Errorf("failed to read CSV headers: %w", err)
+		}
+	} else {
+		// Rows of a headerless file are checked against the supplied columns rather than the first row
+		reader.FieldsPerRecord = -1
+	}
+	if err := validateHeaderPaths(headers); err != nil {
+		return nil, fmt.Errorf("invalid CSV headers: %w", err)
+	}
+
+	result := newParseResult()
+	sink := newRecordSink(ctx, p.database, opts, opts.RecordType, result)
+	var types []ColumnType
+
+	processRow := func(rowNum int, record []string, err error) error {
+		// The reader reports rows of the wrong length as ErrFieldCount but still returns them
+		if err != nil && !errors.Is(err, csv.ErrFieldCount) {
+			return sink.Quarantine(rowNum, record, models.RecordError{Code: models.ErrorCSVRead, Reason: err.Error()})
 		}
 
 		if len(record) != len(headers) {
-			p.database.InsertToQuarantine(ctx, record, userID, recordType, "Mismatched header and record lengths")
-			quarantineCount++
-			continue
+			return sink.Quarantine(rowNum, record, columnCountError(len(record), len(headers)))
 		}
 
-		data := mapRowToKeyValue(headers, record)
-		if !utils.IsValidRecord(data) {
-			p.database.InsertToQuarantine(ctx, record, userID, recordType, "Failed validation")
-			quarantineCount++
-			continue
+		data, recordErr := mapRowToKeyValue(headers, record, types, opts.ColumnTypes)
+		if recordErr != nil {
+			return sink.Quarantine(rowNum, record, *recordErr)
+		}
+
+		return sink.Add(rowNum, data, record)
+	}
+
+	// Buffer the first rows so column types can be inferred before anything is stored
+	type csvRow struct {
+		record []string
+		line   int
+		err    error
+	}
+	var sample []csvRow
+	var sampleRecords [][]string
+	for len(sample) < typeInferenceSampleSize {
+		record, line, err := read()
+		if err == io.EOF {
+			break
+		}
+		if errors.Is(err, errCSVUnreadable) {
+			return nil, err
+		}
+		sample = append(sample, csvRow{record: record, line: line, err: err})
+		if err == nil && len(record) == len(headers) {
+			sampleRecords = append(sampleRecords, record)
 		}
+	}
+
+	types = inferColumnTypes(headers, sampleRecords, opts.ColumnTypes)
 
-		p.database.InsertToValid(ctx, data, userID, recordType)
-		insertCount++
+	for _, row := range sample {
+		if err := processRow(row.line, row.record, row.err); err != nil {
+			return nil, err
+		}
 	}
 
-	resultMsg := fmt.Sprintf("Successfully inserted %d records; quarantined %d records.", insertCount, quarantineCount)
-	w.Write([]byte(resultMsg))
+	for {
+		record, line, err := read()
+		if err == io.EOF {
+			break
+		}
+		if errors.Is(err, errCSVUnreadable) {
+			return nil, err
+		}
+		if err := processRow(line, record, err); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := sink.Flush(); err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
-func mapRowToKeyValue(headers, record []string) map[string]string {
-	data := make(map[string]string)
+// mapRowToKeyValue converts each cell to its column type. Only a column with an explicit type
+// rejects a cell, naming the column; cells of inferred columns are widened to fit.
+// Dotted headers such as "address.city" or "purchases[0].price" build nested maps and arrays.
+func mapRowToKeyValue(headers, record []string, types []ColumnType, explicit map[string]ColumnType) (map[string]interface{}, *models.RecordError) {
+	data := make(map[string]interface{})
 	for i, key := range headers {
-		data[key] = record[i]
+		var value interface{}
+		if _, ok := explicit[key]; ok {
+			var err error
+			value, err = convertCell(record[i], types[i])
+			if err != nil {
+				return nil, models.NewRecordError(models.ErrorTypeConversion, key, fmt.Sprintf("Type error in column %q: %v", key, err))
+			}
+		} else {
+			value = convertInferredCell(record[i], types[i])
+		}
+		// Rows with fewer array elements than the widest row leave trailing cells empty
+		if value == nil && utils.IsArrayFieldPath(key) {
+			continue
+		}
+		if err := utils.SetNestedValue(data, key, value); err != nil {
+			return nil, models.NewRecordError(models.ErrorTypeConversion, key, err.Error())
+		}
+	}
+	return data, nil
+}
+
+// columnCountError reports a row whose number of cells does not match the header.
+func columnCountError(cells, headers int) models.RecordError {
+	return models.RecordError{
+		Code:   models.ErrorColumnCount,
+		Reason: fmt.Sprintf("Row has %d cells but the header has %d columns", cells, headers),
+	}
+}
+
+// validateHeaderPaths rejects headers that cannot form one document, such as "a" next to "a.b".
+func validateHeaderPaths(headers []string) error {
+	data := make(map[string]interface{})
+	for _, key := range headers {
+		if err := utils.SetNestedValue(data, key, ""); err != nil {
+			return err
+		}
 	}
-	return data
+	return nil
 }
@@ -0,0 +1,83 @@
+package parsers
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vd09-projects/my-documentdb-system/internal/models"
+	"github.com/vd09-projects/my-documentdb-system/internal/utils"
+)
+
+// Event time layouts for epoch numbers.
+const (
+	EventTimeUnix       = "unix"
+	EventTimeUnixMillis = "unixMillis"
+)
+
+// ValidateEventTime checks an event time setting before it is saved.
+func ValidateEventTime(eventTime models.EventTime) error {
+	if eventTime.Field == "" {
+		return fmt.Errorf("Event time field is required")
+	}
+	if err := utils.ValidateFieldPath(eventTime.Field); err != nil {
+		return err
+	}
+	switch eventTime.Layout {
+	case "", EventTimeUnix, EventTimeUnixMillis:
+		return nil
+	}
+	// Any text is a valid Go layout, so at least ask for a year
+	if !strings.Contains(eventTime.Layout, "06") {
+		return fmt.Errorf("Layout %q has no year; write it with Go's reference time, e.g. \"02/01/2006\"", eventTime.Layout)
+	}
+	return nil
+}
+
+// extractEventTime reads the event time of a record. Values already parsed as dates, e.g. by
+// CSV type inference or a cast transform, are taken as they are.
+func extractEventTime(data map[string]interface{}, eventTime models.EventTime) (time.Time, *models.RecordError) {
+	value, ok := utils.LookupFieldPath(data, eventTime.Field)
+	if !ok || value == nil {
+		return time.Time{}, models.NewRecordError(models.ErrorInvalidEventTime, eventTime.Field,
+			fmt.Sprintf("Missing event time field %q", eventTime.Field))
+	}
+	if t, ok := value.(time.Time); ok {
+		return t, nil
+	}
+
+	switch eventTime.Layout {
+	case EventTimeUnix, EventTimeUnixMillis:
+		n, ok := toNumber(value)
+		if text, isText := value.(string); isText {
+			f, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+			n, ok = number{f: f}, err == nil
+		}
+		if !ok || math.IsInf(n.float(), 0) || math.IsNaN(n.float()) {
+			return time.Time{}, models.NewRecordError(models.ErrorInvalidEventTime, eventTime.Field, fmt.Sprintf("Invalid event time %v in field %q", value, eventTime.Field))
+		}
+		if eventTime.Layout == EventTimeUnixMillis {
+			return time.UnixMilli(int64(n.float())).UTC(), nil
+		}
+		sec, frac := math.Modf(n.float())
+		return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+	}
+
+	text, ok := value.(string)
+	if !ok {
+		return time.Time{}, models.NewRecordError(models.ErrorInvalidEventTime, eventTime.Field, fmt.Sprintf("Invalid event time %v in field %q", value, eventTime.Field))
+	}
+	text = strings.TrimSpace(text)
+	layouts := utils.DateLayouts
+	if eventTime.Layout != "" {
+		layouts = []string{eventTime.Layout}
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, text); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, models.NewRecordError(models.ErrorInvalidEventTime, eventTime.Field, fmt.Sprintf("Invalid event time %q in field %q", text, eventTime.Field))
+}
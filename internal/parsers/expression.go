@@ -0,0 +1,286 @@
+package parsers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/vd09-projects/my-documentdb-system/internal/utils"
+)
+
+// expression is a compiled arithmetic expression over record fields, as used by the compute
+// transform. It supports numbers, field paths such as "price" or "items[0].qty", parentheses,
+// unary minus and the operators + - * /.
+type expression interface {
+	eval(data map[string]interface{}) (number, error)
+}
+
+// number keeps integers exact: the result of + - * on integers is an integer, anything
+// involving a float or a division is a float. Integer results that overflow int64 are errors.
+type number struct {
+	f     float64
+	i     int64
+	isInt bool
+}
+
+func (n number) float() float64 {
+	if n.isInt {
+		return float64(n.i)
+	}
+	return n.f
+}
+
+func (n number) value() interface{} {
+	if n.isInt {
+		return n.i
+	}
+	return n.f
+}
+
+type literalExpr struct{ n number }
+
+type fieldExpr struct{ path string }
+
+type negateExpr struct{ operand expression }
+
+type binaryExpr struct {
+	op          byte
+	left, right expression
+}
+
+func (e literalExpr) eval(map[string]interface{}) (number, error) {
+	return e.n, nil
+}
+
+func (e fieldExpr) eval(data map[string]interface{}) (number, error) {
+	value, ok := utils.LookupFieldPath(data, e.path)
+	if !ok || value == nil {
+		return number{}, fmt.Errorf("field %q is missing", e.path)
+	}
+	n, ok := toNumber(value)
+	if !ok {
+		return number{}, fmt.Errorf("field %q is not a number", e.path)
+	}
+	return n, nil
+}
+
+// toNumber converts a numeric field value as produced by the parsers.
+func toNumber(value interface{}) (number, bool) {
+	switch v := value.(type) {
+	case int64:
+		return number{i: v, isInt: true}, true
+	case int32:
+		return number{i: int64(v), isInt: true}, true
+	case int:
+		return number{i: int64(v), isInt: true}, true
+	case float64:
+		return number{f: v}, true
+	}
+	return number{}, false
+}
+
+func (e negateExpr) eval(data map[string]interface{}) (number, error) {
+	n, err := e.operand.eval(data)
+	if err != nil {
+		return number{}, err
+	}
+	if n.isInt {
+		if n.i == math.MinInt64 {
+			return number{}, errIntegerOverflow
+		}
+		return number{i: -n.i, isInt: true}, nil
+	}
+	return number{f: -n.f}, nil
+}
+
+func (e binaryExpr) eval(data map[string]interface{}) (number, error) {
+	left, err := e.left.eval(data)
+	if err != nil {
+		return number{}, err
+	}
+	right, err := e.right.eval(data)
+	if err != nil {
+		return number{}, err
+	}
+
+	if e.op == '/' {
+		if right.float() == 0 {
+			return number{}, fmt.Errorf("division by zero")
+		}
+		return number{f: left.float() / right.float()}, nil
+	}
+	if left.isInt && right.isInt {
+		i, ok := intOp(e.op, left.i, right.i)
+		if !ok {
+			return number{}, errIntegerOverflow
+		}
+		return number{i: i, isInt: true}, nil
+	}
+
+	var f float64
+	switch e.op {
+	case '+':
+		f = left.float() + right.float()
+	case '-':
+		f = left.float() - right.float()
+	case '*':
+		f = left.float() * right.float()
+	}
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return number{}, fmt.Errorf("result is out of range")
+	}
+	return number{f: f}, nil
+}
+
+var errIntegerOverflow = errors.New("integer overflow")
+
+// intOp applies + - or * to two integers. It reports false if the result overflows int64.
+func intOp(op byte, a, b int64) (int64, bool) {
+	switch op {
+	case '+':
+		r := a + b
+		return r, (a^r)&(b^r) >= 0
+	case '-':
+		r := a - b
+		return r, (a^b)&(a^r) >= 0
+	case '*':
+		r := a * b
+		if a != 0 && (r/a != b || (a == -1 && b == math.MinInt64)) {
+			return r, false
+		}
+		return r, true
+	}
+	return 0, false
+}
+
+// parseExpression compiles an expression such as "price * quantity" or "(a + b) / 2".
+func parseExpression(src string) (expression, error) {
+	p := &exprParser{src: src}
+	expr, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.src[p.pos], p.pos+1)
+	}
+	return expr, nil
+}
+
+type exprParser struct {
+	src string
+	pos int
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *exprParser) peek() byte {
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+// sum := product (('+' | '-') product)*
+func (p *exprParser) parseSum() (expression, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '+' || op == '-'; op = p.peek() {
+		p.pos++
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// product := unary (('*' | '/') unary)*
+func (p *exprParser) parseProduct() (expression, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '*' || op == '/'; op = p.peek() {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpr{op: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+// unary := '-' unary | primary
+func (p *exprParser) parseUnary() (expression, error) {
+	if p.peek() == '-' {
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return negateExpr{operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+// primary := number | field path | '(' sum ')'
+func (p *exprParser) parsePrimary() (expression, error) {
+	c := p.peek()
+	switch {
+	case c == 0:
+		return nil, fmt.Errorf("unexpected end of expression")
+	case c == '(':
+		p.pos++
+		expr, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("missing ')' at position %d", p.pos+1)
+		}
+		p.pos++
+		return expr, nil
+	case c >= '0' && c <= '9' || c == '.':
+		start := p.pos
+		for p.pos < len(p.src) && (p.src[p.pos] >= '0' && p.src[p.pos] <= '9' || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		text := p.src[start:p.pos]
+		if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return literalExpr{n: number{i: i, isInt: true}}, nil
+		}
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", text)
+		}
+		return literalExpr{n: number{f: f}}, nil
+	case isFieldChar(rune(c)):
+		start := p.pos
+		for p.pos < len(p.src) && (isFieldChar(rune(p.src[p.pos])) || strings.ContainsRune(".[]", rune(p.src[p.pos]))) {
+			p.pos++
+		}
+		path := p.src[start:p.pos]
+		if err := utils.ValidateFieldPath(path); err != nil {
+			return nil, err
+		}
+		return fieldExpr{path: path}, nil
+	}
+	return nil, fmt.Errorf("unexpected %q at position %d", c, p.pos+1)
+}
+
+func isFieldChar(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
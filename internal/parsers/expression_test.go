@@ -0,0 +1,70 @@
+package parsers
+
+import "testing"
+
+func TestParseExpression(t *testing.T) {
+	data := map[string]interface{}{
+		"price":    2.5,
+		"quantity": int64(4),
+		"count":    int32(3),
+		"name":     "widget",
+		"items":    []interface{}{map[string]interface{}{"qty": int64(7)}},
+		"big":      int64(1) << 62,
+	}
+	tests := []struct {
+		name    string
+		src     string
+		want    interface{}
+		wantErr bool
+	}{
+		{name: "integer arithmetic stays integer", src: "quantity * 2 + count", want: int64(11)},
+		{name: "precedence", src: "1 + 2 * 3 - 4", want: int64(3)},
+		{name: "left associative", src: "10 - 4 - 3", want: int64(3)},
+		{name: "parentheses", src: "(1 + 2) * 3", want: int64(9)},
+		{name: "unary minus", src: "-quantity - -2", want: int64(-2)},
+		{name: "float operand", src: "price * quantity", want: 10.0},
+		{name: "division is float", src: "quantity / 8", want: 0.5},
+		{name: "decimal literal", src: ".5 + 1", want: 1.5},
+		{name: "array path", src: "items[0].qty * 2", want: int64(14)},
+		{name: "spaces and tabs", src: " \tquantity\t*quantity ", want: int64(16)},
+		{name: "division by zero", src: "quantity / (count - 3)", wantErr: true},
+		{name: "missing field", src: "discount * 2", wantErr: true},
+		{name: "text field", src: "name + 1", wantErr: true},
+		{name: "addition overflow", src: "big + big", wantErr: true},
+		{name: "subtraction overflow", src: "-big - big - big", wantErr: true},
+		{name: "multiplication overflow", src: "big * 4", wantErr: true},
+		{name: "negation overflow", src: "-(-big - big)", wantErr: true},
+		{name: "largest integer", src: "big - 1 + big", want: int64(1<<63 - 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := parseExpression(tt.src)
+			if err != nil {
+				t.Fatalf("parseExpression(%q): %v", tt.src, err)
+			}
+			n, err := expr.eval(data)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("eval(%q) = %v, want an error", tt.src, n.value())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("eval(%q): %v", tt.src, err)
+			}
+			if n.value() != tt.want {
+				t.Errorf("eval(%q) = %#v, want %#v", tt.src, n.value(), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	for _, src := range []string{"", "1 +", "(1 + 2", "1 + 2)", "price * * 2", "1..2", "price $ 2", "items[x]"} {
+		t.Run(src, func(t *testing.T) {
+			if _, err := parseExpression(src); err == nil {
+				t.Errorf("parseExpression(%q) succeeded, want an error", src)
+			}
+		})
+	}
+}
@@ -1,56 +1,230 @@
 package parsers
 
 import (
+	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"net/http"
 
 	"github.com/vd09-projects/my-documentdb-system/internal/db"
-	"github.com/vd09-projects/my-documentdb-system/internal/utils"
+	"github.com/vd09-projects/my-documentdb-system/internal/models"
 )
 
 type JSONParser struct {
 	database db.Database
 }
 
-func (p *JSONParser) Parse(ctx context.Context, file io.Reader, w http.ResponseWriter, userID string, recordType string) {
-	dataBytes, err := io.ReadAll(file)
-	if err != nil {
-		http.Error(w, "Failed to read JSON file", http.StatusInternalServerError)
-		return
+func init() {
+	Register(Format{
+		Name:       "json",
+		MIMETypes:  []string{"application/json", "text/json"},
+		Extensions: []string{".json"},
+		Sniff: func(head []byte) bool {
+			head = trimHead(head)
+			return len(head) > 0 && (head[0] == '[' || head[0] == '{') && !sniffNDJSON(head)
+		},
+		New: func(database db.Database) Parser {
+			return &JSONParser{database: database}
+		},
+	})
+}
+
+func (p *JSONParser) Parse(ctx context.Context, file io.Reader, opts ParseOptions) (*ParseResult, error) {
+	reader := bufio.NewReader(file)
+
+	first, err := peekNonSpace(reader)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read JSON file: %w", err)
 	}
 
-	var jsonRecords []map[string]interface{}
-	var insertCount, quarantineCount int
+	result := newParseResult()
+	sink := newRecordSink(ctx, p.database, opts, opts.RecordType, result)
 
-	if err := json.Unmarshal(dataBytes, &jsonRecords); err == nil {
-		for _, rec := range jsonRecords {
-			if !utils.IsValidRecord(rec) {
-				p.database.InsertToQuarantine(ctx, rec, userID, recordType, "Failed validation")
-				quarantineCount++
-				continue
+	if first == '[' {
+		// Stream the array element by element so memory stays bounded by the largest record
+		reader.ReadByte()
+		elements := &jsonArrayReader{r: reader}
+		for index := 0; ; index++ {
+			raw, err := elements.Next()
+			if err == io.EOF {
+				break
+			}
+			if err == errJSONTrailingData {
+				if storeErr := sink.Quarantine(index+1, string(raw), models.RecordError{Code: models.ErrorInvalidJSON, Reason: "Invalid JSON: " + err.Error()}); storeErr != nil {
+					return nil, storeErr
+				}
+				break
+			}
+			if err != nil && err != io.ErrUnexpectedEOF {
+				return nil, fmt.Errorf("failed to read JSON file: %w", err)
+			}
+
+			var rec map[string]interface{}
+			var storeErr error
+			if jsonErr := json.Unmarshal(raw, &rec); jsonErr != nil || rec == nil {
+				storeErr = sink.Quarantine(index+1, string(raw), jsonRecordError(fmt.Sprintf("Invalid JSON element at index %d", index), jsonErr))
+			} else {
+				storeErr = sink.Add(index+1, rec, rec)
+			}
+			if storeErr != nil {
+				return nil, storeErr
+			}
+
+			if err == io.ErrUnexpectedEOF {
+				break
 			}
-			p.database.InsertToValid(ctx, rec, userID, recordType)
-			insertCount++
 		}
 	} else {
+		dataBytes, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JSON file: %w", err)
+		}
+
 		var singleRec map[string]interface{}
-		if err := json.Unmarshal(dataBytes, &singleRec); err != nil {
-			p.database.InsertToQuarantine(ctx, string(dataBytes), userID, recordType, "Invalid JSON structure")
-			quarantineCount++
+		if err := json.Unmarshal(dataBytes, &singleRec); err != nil || singleRec == nil {
+			err = sink.Quarantine(1, string(dataBytes), jsonRecordError("Invalid JSON structure", err))
 		} else {
-			if !utils.IsValidRecord(singleRec) {
-				p.database.InsertToQuarantine(ctx, singleRec, userID, recordType, "Failed validation")
-				quarantineCount++
-			} else {
-				p.database.InsertToValid(ctx, singleRec, userID, recordType)
-				insertCount++
+			err = sink.Add(1, singleRec, singleRec)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := sink.Flush(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// peekNonSpace skips leading whitespace and returns the next byte without consuming it.
+func peekNonSpace(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			r.ReadByte()
+		default:
+			return b[0], nil
+		}
+	}
+}
+
+// errJSONTrailingData is returned by jsonArrayReader.Next for input after the closing bracket.
+var errJSONTrailingData = errors.New("unexpected data after the closing bracket")
+
+// maxTrailingDataBytes caps how much of the input after the array is kept for quarantine.
+const maxTrailingDataBytes = 1024
+
+// jsonArrayReader splits the body of a top-level JSON array into raw elements.
+// It only tracks strings and bracket depth, so a malformed element is still
+// returned on its own and can be quarantined without aborting the rest of the array.
+type jsonArrayReader struct {
+	r      *bufio.Reader
+	closed bool
+	done   bool
+}
+
+// Next returns the raw bytes of the next element. Once the closing bracket has been
+// consumed it returns errJSONTrailingData with the start of any non-space input that
+// follows, then io.EOF. It returns io.ErrUnexpectedEOF together with the partial element
+// when the input ends before the array is closed.
+func (a *jsonArrayReader) Next() ([]byte, error) {
+	if a.done {
+		return nil, io.EOF
+	}
+	if a.closed {
+		return a.trailing()
+	}
+
+	var elem []byte
+	depth := 0
+	inString, escaped := false, false
+
+	for {
+		c, err := a.r.ReadByte()
+		if err == io.EOF {
+			a.done = true
+			elem = bytes.TrimSpace(elem)
+			if len(elem) == 0 {
+				return nil, io.EOF
+			}
+			return elem, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if inString {
+			elem = append(elem, c)
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
 			}
+			continue
 		}
+
+		switch c {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+		case '}', ']':
+			if depth == 0 && c == ']' {
+				a.closed = true
+				elem = bytes.TrimSpace(elem)
+				if len(elem) == 0 {
+					// Empty array or trailing comma
+					return a.trailing()
+				}
+				return elem, nil
+			}
+			// An unmatched closer makes the element malformed; keep it in the element
+			// and carry on to the next top-level comma or bracket
+			if depth > 0 {
+				depth--
+			}
+		case ',':
+			if depth == 0 {
+				return bytes.TrimSpace(elem), nil
+			}
+		}
+		elem = append(elem, c)
 	}
+}
 
-	resultMsg := fmt.Sprintf("Successfully inserted %d records; quarantined %d records.", insertCount, quarantineCount)
-	w.Write([]byte(resultMsg))
+// trailing reads what is left after the closing bracket.
+func (a *jsonArrayReader) trailing() ([]byte, error) {
+	a.done = true
+	rest, err := io.ReadAll(io.LimitReader(a.r, maxTrailingDataBytes))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(io.Discard, a.r); err != nil {
+		return nil, err
+	}
+	rest = bytes.TrimSpace(rest)
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	return rest, errJSONTrailingData
+}
+
+// jsonRecordError describes a JSON record that could not be decoded into an object. Valid JSON
+// of another type, such as an array or null, is reported as NOT_AN_OBJECT.
+func jsonRecordError(reason string, err error) models.RecordError {
+	var typeErr *json.UnmarshalTypeError
+	if err == nil || errors.As(err, &typeErr) {
+		return models.RecordError{Code: models.ErrorNotObject, Reason: reason + ": not a JSON object"}
+	}
+	return models.RecordError{Code: models.ErrorInvalidJSON, Reason: fmt.Sprintf("%s: %v", reason, err)}
 }
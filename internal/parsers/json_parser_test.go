@@ -0,0 +1,96 @@
+package parsers
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vd09-projects/my-documentdb-system/internal/models"
+)
+
+func TestJSONArrayReader(t *testing.T) {
+	// Inputs start after the opening bracket, which the parser consumes first
+	tests := []struct {
+		name    string
+		input   string
+		want    []string
+		lastErr error
+	}{
+		{name: "empty array", input: "]", want: nil, lastErr: io.EOF},
+		{name: "blank array", input: " \n ]", want: nil, lastErr: io.EOF},
+		{name: "objects", input: `{"a": 1}, {"a": 2}]`, want: []string{`{"a": 1}`, `{"a": 2}`}, lastErr: io.EOF},
+		{name: "nested values", input: `{"a": [1, {"b": [2, 3]}]}, [4, 5]]`, want: []string{`{"a": [1, {"b": [2, 3]}]}`, `[4, 5]`}, lastErr: io.EOF},
+		{name: "brackets and commas in strings", input: `{"a": "x, ] } ["}, {"b": "\"],"}]`, want: []string{`{"a": "x, ] } ["}`, `{"b": "\"],"}`}, lastErr: io.EOF},
+		{name: "escaped backslash before quote", input: `{"a": "c:\\"}, 1]`, want: []string{`{"a": "c:\\"}`, `1`}, lastErr: io.EOF},
+		{name: "trailing comma", input: `{"a": 1},]`, want: []string{`{"a": 1}`}, lastErr: io.EOF},
+		{name: "malformed element is kept apart", input: `{"a": }, {"b": 2}]`, want: []string{`{"a": }`, `{"b": 2}`}, lastErr: io.EOF},
+		{name: "unclosed array", input: `{"a": 1}, {"b": 2`, want: []string{`{"a": 1}`, `{"b": 2`}, lastErr: io.ErrUnexpectedEOF},
+		{name: "unclosed after comma", input: `{"a": 1}, `, want: []string{`{"a": 1}`}, lastErr: io.EOF},
+		{name: "stray closing brace", input: `{"a": 1}}, {"b": 2}]`, want: []string{`{"a": 1}}`, `{"b": 2}`}, lastErr: io.EOF},
+		{name: "stray closing brace at the start", input: `}{"a": 1}, {"b": 2}]`, want: []string{`}{"a": 1}`, `{"b": 2}`}, lastErr: io.EOF},
+		{name: "mismatched closer", input: `{"a": 1], {"b": 2}]`, want: []string{`{"a": 1]`, `{"b": 2}`}, lastErr: io.EOF},
+		{name: "space after the array", input: "{\"a\": 1}]\n\t ", want: []string{`{"a": 1}`}, lastErr: io.EOF},
+		{name: "data after the array", input: `{"a": 1}] {"b": 2}`, want: []string{`{"a": 1}`, `{"b": 2}`}, lastErr: errJSONTrailingData},
+		{name: "data after an empty array", input: `], 1`, want: []string{`, 1`}, lastErr: errJSONTrailingData},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			elements := &jsonArrayReader{r: bufio.NewReader(strings.NewReader(tt.input))}
+			var got []string
+			var err error
+			for {
+				var raw []byte
+				raw, err = elements.Next()
+				if raw != nil {
+					got = append(got, string(raw))
+				}
+				if err != nil {
+					break
+				}
+			}
+			if err != tt.lastErr {
+				t.Errorf("last error = %v, want %v", err, tt.lastErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("elements = %q, want %q", got, tt.want)
+			}
+			if raw, err := elements.Next(); raw != nil || err != io.EOF {
+				t.Errorf("Next after the end = %q, %v; want io.EOF", raw, err)
+			}
+		})
+	}
+}
+
+func TestJSONParserQuarantinesNull(t *testing.T) {
+	preview := NewPreviewDatabase(nil, 10)
+	parser := &JSONParser{database: preview}
+	result, err := parser.Parse(context.Background(), strings.NewReader("null"), ParseOptions{UserID: "u", RecordType: "events"})
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if result.Inserted != 0 || len(result.Errors) != 1 || result.Errors[0].Code != models.ErrorNotObject {
+		t.Errorf("result = %+v, want one NOT_AN_OBJECT error", result)
+	}
+}
+
+func TestJSONParserQuarantinesTrailingData(t *testing.T) {
+	preview := NewPreviewDatabase(nil, 10)
+	parser := &JSONParser{database: preview}
+	input := `[{"userId": "u"}}, {"userId": "u"}] {"userId": "u"}`
+	result, err := parser.Parse(context.Background(), strings.NewReader(input), ParseOptions{UserID: "u", RecordType: "events"})
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if result.Inserted != 1 || len(result.Errors) != 2 {
+		t.Fatalf("result = %+v, want 1 inserted and 2 errors", result)
+	}
+	if got := result.Errors[0]; got.Row != 1 || got.Code != models.ErrorInvalidJSON {
+		t.Errorf("first error = %+v, want the stray brace at row 1", got)
+	}
+	if got := result.Errors[1]; got.Row != 3 || got.Code != models.ErrorInvalidJSON {
+		t.Errorf("second error = %+v, want the trailing data at row 3", got)
+	}
+}
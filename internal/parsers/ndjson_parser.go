@@ -0,0 +1,78 @@
+package parsers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/vd09-projects/my-documentdb-system/internal/db"
+)
+
+// NDJSONParser handles newline-delimited JSON (JSON Lines), one record per line.
+type NDJSONParser struct {
+	database db.Database
+}
+
+func init() {
+	Register(Format{
+		Name:       "ndjson",
+		MIMETypes:  []string{"application/x-ndjson", "application/ndjson", "application/jsonl", "application/x-jsonlines"},
+		Extensions: []string{".ndjson", ".jsonl"},
+		Sniff:      sniffNDJSON,
+		New: func(database db.Database) Parser {
+			return &NDJSONParser{database: database}
+		},
+	})
+}
+
+// sniffNDJSON recognises a complete JSON object on the first line followed by another object.
+func sniffNDJSON(head []byte) bool {
+	first, rest, found := bytes.Cut(trimHead(head), []byte("\n"))
+	first = bytes.TrimSpace(first)
+	rest = bytes.TrimSpace(rest)
+	return found && len(first) > 0 && first[0] == '{' && json.Valid(first) && len(rest) > 0 && rest[0] == '{'
+}
+
+func (p *NDJSONParser) Parse(ctx context.Context, file io.Reader, opts ParseOptions) (*ParseResult, error) {
+	reader := bufio.NewReader(file)
+
+	result := newParseResult()
+	sink := newRecordSink(ctx, p.database, opts, opts.RecordType, result)
+	lineNum := 0
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("failed to read NDJSON file: %w", err)
+		}
+		if len(line) > 0 {
+			lineNum++
+		}
+
+		line = bytes.TrimSpace(line)
+		if len(line) > 0 {
+			var rec map[string]interface{}
+			var storeErr error
+			if jsonErr := json.Unmarshal(line, &rec); jsonErr != nil || rec == nil {
+				storeErr = sink.Quarantine(lineNum, string(line), jsonRecordError(fmt.Sprintf("Invalid JSON on line %d", lineNum), jsonErr))
+			} else {
+				storeErr = sink.Add(lineNum, rec, rec)
+			}
+			if storeErr != nil {
+				return nil, storeErr
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	if err := sink.Flush(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,38 @@
+package parsers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/vd09-projects/my-documentdb-system/internal/models"
+)
+
+func TestNDJSONParserQuarantinesNonObjects(t *testing.T) {
+	input := "{\"userId\": \"u\"}\nnull\n[1, 2]\n{\"a\": \n\n{\"userId\": \"u\"}\n"
+	preview := NewPreviewDatabase(nil, 10)
+	parser := &NDJSONParser{database: preview}
+	result, err := parser.Parse(context.Background(), strings.NewReader(input), ParseOptions{UserID: "u", RecordType: "events"})
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if result.Inserted != 2 || len(preview.Records()) != 2 {
+		t.Errorf("inserted %d records, kept %d; want 2", result.Inserted, len(preview.Records()))
+	}
+	want := []struct {
+		row  int
+		code string
+	}{
+		{2, models.ErrorNotObject},
+		{3, models.ErrorNotObject},
+		{4, models.ErrorInvalidJSON},
+	}
+	if len(result.Errors) != len(want) {
+		t.Fatalf("errors = %+v, want %d", result.Errors, len(want))
+	}
+	for i, w := range want {
+		if got := result.Errors[i]; got.Row != w.row || got.Code != w.code {
+			t.Errorf("error %d = row %d %s, want row %d %s", i, got.Row, got.Code, w.row, w.code)
+		}
+	}
+}
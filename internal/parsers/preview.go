@@ -0,0 +1,100 @@
+package parsers
+
+import (
+	"context"
+	"time"
+
+	"github.com/vd09-projects/my-documentdb-system/internal/db"
+	"github.com/vd09-projects/my-documentdb-system/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// PreviewRecord is a record a dry run would have stored, as the preview shows it.
+type PreviewRecord struct {
+	Entry         string      `json:"entry,omitempty"`
+	Row           int         `json:"row,omitempty"`
+	RecordType    string      `json:"recordType"`
+	Data          interface{} `json:"data"`
+	SchemaVersion int         `json:"schemaVersion,omitempty"`
+	NaturalKey    string      `json:"naturalKey,omitempty"`
+	EventTime     *time.Time  `json:"eventTime,omitempty"`
+}
+
+// PreviewDatabase is a db.Database for dry runs: parsers write to it as usual, but nothing is
+// stored. It keeps the first records it is given so they can be shown. Reads go to database.
+// Every method is implemented here rather than embedded, so a write method added to
+// db.Database cannot reach MongoDB from a dry run.
+type PreviewDatabase struct {
+	reads   db.Database
+	limit   int
+	records []PreviewRecord
+}
+
+// NewPreviewDatabase returns a PreviewDatabase keeping up to limit records.
+func NewPreviewDatabase(database db.Database, limit int) *PreviewDatabase {
+	return &PreviewDatabase{reads: database, limit: limit, records: []PreviewRecord{}}
+}
+
+// Records returns the records kept so far, in the order they were parsed.
+func (d *PreviewDatabase) Records() []PreviewRecord {
+	return d.records
+}
+
+func (d *PreviewDatabase) InsertToValid(ctx context.Context, record db.ValidRecord, userID string, recordType string) error {
+	d.keep(record, recordType)
+	return nil
+}
+
+func (d *PreviewDatabase) InsertManyToValid(ctx context.Context, records []db.ValidRecord, userID string, recordType string) error {
+	for _, record := range records {
+		d.keep(record, recordType)
+	}
+	return nil
+}
+
+func (d *PreviewDatabase) InsertToRecordFields(ctx context.Context, data interface{}, userID string, recordType string) error {
+	return nil
+}
+
+// InsertToQuarantine discards the record; the parser already lists it in ParseResult.Errors.
+func (d *PreviewDatabase) InsertToQuarantine(ctx context.Context, data interface{}, userID string, recordType string, recordErr models.RecordError, provenance *models.Provenance) error {
+	return nil
+}
+
+func (d *PreviewDatabase) GetAllValidData(ctx context.Context) ([]bson.M, error) {
+	return d.reads.GetAllValidData(ctx)
+}
+
+func (d *PreviewDatabase) GetUserData(ctx context.Context, userID string, timeRange db.TimeRange) ([]bson.M, error) {
+	return d.reads.GetUserData(ctx, userID, timeRange)
+}
+
+func (d *PreviewDatabase) GetRecordTypesForUser(ctx context.Context, userID string) ([]bson.M, error) {
+	return d.reads.GetRecordTypesForUser(ctx, userID)
+}
+
+func (d *PreviewDatabase) GetFieldsForUserAndType(ctx context.Context, userID string, recordType string) (bson.M, error) {
+	return d.reads.GetFieldsForUserAndType(ctx, userID, recordType)
+}
+
+func (d *PreviewDatabase) AggregateData(ctx context.Context, userID, recordType, field string, timeRange db.TimeRange) ([]float64, error) {
+	return d.reads.AggregateData(ctx, userID, recordType, field, timeRange)
+}
+
+func (d *PreviewDatabase) keep(record db.ValidRecord, recordType string) {
+	if len(d.records) >= d.limit {
+		return
+	}
+	preview := PreviewRecord{
+		RecordType:    recordType,
+		Data:          record.Data,
+		SchemaVersion: record.SchemaVersion,
+		NaturalKey:    record.NaturalKey,
+		EventTime:     record.EventTime,
+	}
+	if record.Provenance != nil {
+		preview.Entry = record.Provenance.Entry
+		preview.Row = record.Provenance.Row
+	}
+	d.records = append(d.records, preview)
+}
@@ -0,0 +1,141 @@
+package parsers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/vd09-projects/my-documentdb-system/internal/db"
+)
+
+// SniffLength is how much of a file DetectFormat needs to recognise it by content.
+const SniffLength = 8 << 10
+
+// Format is a file format a parser can read. Formats are recognised by extension, then by
+// MIME type, then by content.
+type Format struct {
+	// Name identifies the format, e.g. "csv". It is stored with each upload.
+	Name string
+	// MIMETypes lists the media types of the format, e.g. "text/csv".
+	MIMETypes []string
+	// Extensions lists the file name extensions of the format, including the dot, e.g. ".csv".
+	// They are matched ignoring case.
+	Extensions []string
+	// Sniff reports whether the first bytes of a file, up to SniffLength, hold this format.
+	// It may be nil for formats that cannot be told apart by content.
+	Sniff func(head []byte) bool
+	// New returns a parser for the format that stores records in database.
+	New func(database db.Database) Parser
+	// Compression names the compression of a file Detect found inside a gzip or zstd file,
+	// e.g. "gzip". It is empty for registered formats.
+	Compression string
+}
+
+var (
+	formatsMu sync.RWMutex
+	formats   []Format
+)
+
+// Register makes a format available to DetectFormat and FormatByName. Formats registered later
+// take precedence on a shared extension or MIME type, so an in-house parser can replace a
+// built-in one. Registering a name twice panics.
+func Register(format Format) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	if format.Name == "" || format.New == nil {
+		panic("parsers: Register needs a format name and a constructor")
+	}
+	for _, f := range formats {
+		if f.Name == format.Name {
+			panic("parsers: format " + format.Name + " registered twice")
+		}
+	}
+	formats = append(formats, format)
+}
+
+// FormatByName returns the registered format with the given name.
+func FormatByName(name string) (Format, bool) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	for _, f := range formats {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Format{}, false
+}
+
+// FormatNames lists the registered formats in registration order.
+func FormatNames() []string {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	names := make([]string, len(formats))
+	for i, f := range formats {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// DetectFormat picks the format of an uploaded file from its name, its declared content type
+// and its first bytes, as returned by Peek. Generic content types such as text/plain and
+// application/octet-stream are ignored in favour of the content.
+func DetectFormat(fileName, contentType string, head []byte) (Format, bool) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+
+	if ext := strings.ToLower(filepath.Ext(fileName)); ext != "" {
+		for i := len(formats) - 1; i >= 0; i-- {
+			for _, e := range formats[i].Extensions {
+				if strings.ToLower(e) == ext {
+					return formats[i], true
+				}
+			}
+		}
+	}
+
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		for i := len(formats) - 1; i >= 0; i-- {
+			for _, m := range formats[i].MIMETypes {
+				if m == mediaType {
+					return formats[i], true
+				}
+			}
+		}
+	}
+
+	if len(head) > 0 {
+		for i := len(formats) - 1; i >= 0; i-- {
+			if formats[i].Sniff != nil && formats[i].Sniff(head) {
+				return formats[i], true
+			}
+		}
+	}
+	return Format{}, false
+}
+
+// UnsupportedFormatError is the message for a file no registered format recognises.
+func UnsupportedFormatError() error {
+	return fmt.Errorf("Unsupported file type. Supported formats: %s (optionally gzip or zstd compressed)",
+		strings.Join(FormatNames(), ", "))
+}
+
+// Peek reads the first SniffLength bytes of r for DetectFormat. The returned reader still
+// yields the whole content.
+func Peek(r io.Reader) ([]byte, io.Reader, error) {
+	head := make([]byte, SniffLength)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, nil, err
+	}
+	head = head[:n]
+	return head, io.MultiReader(bytes.NewReader(head), r), nil
+}
+
+// trimHead drops a UTF-8 byte order mark and leading white space before sniffing.
+func trimHead(head []byte) []byte {
+	return bytes.TrimLeft(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")), " \t\r\n")
+}
@@ -0,0 +1,74 @@
+package parsers
+
+import "testing"
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name        string
+		fileName    string
+		contentType string
+		head        string
+		want        string
+		ok          bool
+	}{
+		{name: "extension", fileName: "orders.csv", want: "csv", ok: true},
+		{name: "extension is case insensitive", fileName: "ORDERS.JSON", want: "json", ok: true},
+		{name: "jsonl extension", fileName: "events.jsonl", want: "ndjson", ok: true},
+		{name: "extension wins over content type", fileName: "orders.csv", contentType: "application/json", want: "csv", ok: true},
+		{name: "extension wins over content", fileName: "orders.xml", head: "a,b\n1,2\n", want: "xml", ok: true},
+		{name: "content type", fileName: "upload", contentType: "application/x-ndjson", want: "ndjson", ok: true},
+		{name: "content type with parameters", contentType: "text/csv; charset=utf-8", want: "csv", ok: true},
+		{name: "content type wins over content", contentType: "text/xml", head: `{"a": 1}`, want: "xml", ok: true},
+		{name: "generic content type falls back to content", fileName: "upload", contentType: "text/plain", head: "a;b\n1;2\n", want: "csv", ok: true},
+		{name: "unknown extension falls back to content", fileName: "orders.txt", head: "a\tb\n1\t2\n", want: "csv", ok: true},
+		{name: "sniffed json array", head: `[{"a": 1}]`, want: "json", ok: true},
+		{name: "sniffed json object", head: "\xef\xbb\xbf  {\"a\": 1}", want: "json", ok: true},
+		{name: "sniffed ndjson", head: "{\"a\": 1}\n{\"a\": 2}\n", want: "ndjson", ok: true},
+		{name: "sniffed xml", head: "\n<?xml version=\"1.0\"?><rows/>", want: "xml", ok: true},
+		{name: "sniffed xlsx", head: "PK\x03\x04....[Content_Types].xml", want: "xlsx", ok: true},
+		{name: "sniffed zip", head: "PK\x03\x04....orders.csv", want: "zip", ok: true},
+		{name: "single column text", head: "name\nalice\n", ok: false},
+		{name: "binary", head: "\x00\x01\x02,\x03", ok: false},
+		{name: "nothing to go on", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format, ok := DetectFormat(tt.fileName, tt.contentType, []byte(tt.head))
+			if ok != tt.ok {
+				t.Fatalf("DetectFormat ok = %v, want %v", ok, tt.ok)
+			}
+			if format.Name != tt.want {
+				t.Errorf("DetectFormat = %q, want %q", format.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestSniffers(t *testing.T) {
+	tests := []struct {
+		name  string
+		sniff func([]byte) bool
+		head  string
+		want  bool
+	}{
+		{name: "csv comma", sniff: sniffCSV, head: "a,b,c\n1,2,3", want: true},
+		{name: "csv pipe", sniff: sniffCSV, head: "a|b\n", want: true},
+		{name: "csv after bom", sniff: sniffCSV, head: "\xef\xbb\xbfa;b\n", want: true},
+		{name: "csv rejects json", sniff: sniffCSV, head: `{"a": 1, "b": 2}`, want: false},
+		{name: "csv rejects xml", sniff: sniffCSV, head: "<a>1,2</a>", want: false},
+		{name: "csv rejects invalid utf-8", sniff: sniffCSV, head: "a,\xff\xfe\n", want: false},
+		{name: "csv needs a separator on the first line", sniff: sniffCSV, head: "abc\n1,2", want: false},
+		{name: "ndjson", sniff: sniffNDJSON, head: "{\"a\": 1}\r\n{\"a\": 2}", want: true},
+		{name: "ndjson needs a second object", sniff: sniffNDJSON, head: "{\"a\": 1}\n", want: false},
+		{name: "ndjson rejects a pretty printed object", sniff: sniffNDJSON, head: "{\n  \"a\": 1\n}", want: false},
+		{name: "xlsx", sniff: sniffXLSX, head: "PK\x03\x04 xl/workbook.xml", want: true},
+		{name: "xlsx rejects a plain zip", sniff: sniffXLSX, head: "PK\x03\x04 orders.csv", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.sniff([]byte(tt.head)); got != tt.want {
+				t.Errorf("sniff(%q) = %v, want %v", tt.head, got, tt.want)
+			}
+		})
+	}
+}
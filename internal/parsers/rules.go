@@ -0,0 +1,62 @@
+package parsers
+
+import (
+	"github.com/vd09-projects/my-documentdb-system/internal/db"
+	"github.com/vd09-projects/my-documentdb-system/internal/models"
+	"github.com/vd09-projects/my-documentdb-system/internal/utils"
+)
+
+// RecordRules are the checks a record of one record type goes through before it is stored.
+type RecordRules struct {
+	schema     *utils.VersionedSchema
+	naturalKey []string
+	transforms *TransformPipeline
+	eventTime  *models.EventTime
+}
+
+// Rules returns the rules opts holds for a record type.
+func (opts ParseOptions) Rules(recordType string) RecordRules {
+	return RecordRules{
+		schema:     opts.Schemas[recordType],
+		naturalKey: opts.NaturalKeys[recordType],
+		transforms: opts.Transforms[recordType],
+		eventTime:  opts.EventTimes[recordType],
+	}
+}
+
+// Check runs the transforms on a copy of data, validates the result and builds the record to
+// store. Record types with a schema are checked against it and stamped with its version; the
+// others only need a "userId" field. Record types with a natural key need every key field,
+// and those with an event time need a readable event time. When a check fails, Check returns
+// the error the record should be quarantined with.
+func (r RecordRules) Check(data map[string]interface{}) (db.ValidRecord, *models.RecordError) {
+	if r.transforms != nil {
+		data = utils.FromBSON(data).(map[string]interface{})
+		if recordErr := r.transforms.Apply(data); recordErr != nil {
+			return db.ValidRecord{}, recordErr
+		}
+	}
+	if recordErr := utils.ValidateRecord(r.schema, data); recordErr != nil {
+		return db.ValidRecord{}, recordErr
+	}
+
+	record := db.ValidRecord{Data: data}
+	if r.schema != nil {
+		record.SchemaVersion = r.schema.Version
+	}
+	if len(r.naturalKey) > 0 {
+		key, recordErr := utils.NaturalKey(data, r.naturalKey)
+		if recordErr != nil {
+			return db.ValidRecord{}, recordErr
+		}
+		record.NaturalKey = key
+	}
+	if r.eventTime != nil {
+		eventTime, recordErr := extractEventTime(data, *r.eventTime)
+		if recordErr != nil {
+			return db.ValidRecord{}, recordErr
+		}
+		record.EventTime = &eventTime
+	}
+	return record, nil
+}
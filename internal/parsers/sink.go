@@ -0,0 +1,83 @@
+package parsers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/vd09-projects/my-documentdb-system/internal/db"
+	"github.com/vd09-projects/my-documentdb-system/internal/models"
+	"github.com/vd09-projects/my-documentdb-system/internal/utils"
+)
+
+// recordSink validates parsed records of one record type, routes them to valid or
+// quarantine storage and keeps the ParseResult up to date.
+type recordSink struct {
+	ctx        context.Context
+	database   db.Database
+	userID     string
+	recordType string
+	rules      RecordRules
+	opts       ParseOptions
+	batch      *recordBatch
+	result     *ParseResult
+}
+
+func newRecordSink(ctx context.Context, database db.Database, opts ParseOptions, recordType string, result *ParseResult) *recordSink {
+	return &recordSink{
+		ctx:        ctx,
+		database:   database,
+		userID:     opts.UserID,
+		recordType: recordType,
+		rules:      opts.Rules(recordType),
+		opts:       opts,
+		batch:      newRecordBatch(ctx, database, opts.UserID, recordType),
+		result:     result,
+	}
+}
+
+// Add checks a parsed record against the rules of its record type and queues it for storage.
+// raw is what gets quarantined when a check fails, e.g. the original CSV row; it is kept as
+// received, before any transform.
+func (s *recordSink) Add(row int, data map[string]interface{}, raw interface{}) error {
+	record, recordErr := s.rules.Check(data)
+	if recordErr != nil {
+		return s.Quarantine(row, raw, *recordErr)
+	}
+	record.Provenance = s.provenance(row)
+	if err := s.batch.Add(record); err != nil {
+		return fmt.Errorf("failed to store records: %w", err)
+	}
+	s.result.Inserted++
+	s.result.addFields(utils.TraverseDynamicJSON(record.Data))
+	return nil
+}
+
+// Quarantine stores a record that could not be parsed or validated.
+func (s *recordSink) Quarantine(row int, raw interface{}, recordErr models.RecordError) error {
+	if err := s.database.InsertToQuarantine(s.ctx, raw, s.userID, s.recordType, recordErr, s.provenance(row)); err != nil {
+		return fmt.Errorf("failed to quarantine record: %w", err)
+	}
+	s.result.addError(row, recordErr)
+	return nil
+}
+
+func (s *recordSink) provenance(row int) *models.Provenance {
+	if s.opts.BatchID == "" {
+		return nil
+	}
+	return &models.Provenance{
+		BatchID:    s.opts.BatchID,
+		FileName:   s.opts.FileName,
+		Entry:      s.opts.Entry,
+		Row:        row,
+		UploadedBy: s.opts.UploadedBy,
+	}
+}
+
+// Flush writes the records still queued. It must be called once parsing is done.
+func (s *recordSink) Flush() error {
+	if err := s.batch.Flush(); err != nil {
+		return fmt.Errorf("failed to store records: %w", err)
+	}
+	return nil
+}
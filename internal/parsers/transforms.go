@@ -0,0 +1,284 @@
+package parsers
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vd09-projects/my-documentdb-system/internal/models"
+	"github.com/vd09-projects/my-documentdb-system/internal/utils"
+)
+
+// Transform ops, see models.Transform.
+const (
+	TransformRename  = "rename"
+	TransformCast    = "cast"
+	TransformDrop    = "drop"
+	TransformDefault = "default"
+	TransformSplit   = "split"
+	TransformConcat  = "concat"
+	TransformCompute = "compute"
+)
+
+// TransformPipeline is the checked, ready to run form of a record type's transforms.
+type TransformPipeline struct {
+	steps []transformStep
+}
+
+type transformStep struct {
+	models.Transform
+	expr expression
+}
+
+// CompileTransforms checks a list of transforms and prepares them to run.
+func CompileTransforms(transforms []models.Transform) (*TransformPipeline, error) {
+	pipeline := &TransformPipeline{}
+	for i, t := range transforms {
+		step := transformStep{Transform: t}
+		if err := step.compile(); err != nil {
+			return nil, fmt.Errorf("Transform %d (%s): %v", i+1, t.Op, err)
+		}
+		pipeline.steps = append(pipeline.steps, step)
+	}
+	return pipeline, nil
+}
+
+func (s *transformStep) compile() error {
+	// paths lists every field the step reads or writes; written ones must end with a key
+	var paths, written []string
+	switch s.Op {
+	case TransformRename:
+		if s.To == "" {
+			return fmt.Errorf("\"to\" is required")
+		}
+		paths = []string{s.Field, s.To}
+		written = []string{s.Field, s.To}
+	case TransformCast:
+		if !ColumnType(s.Type).valid() {
+			return fmt.Errorf("unsupported type %q", s.Type)
+		}
+		paths = []string{s.Field}
+		written = paths
+	case TransformDrop:
+		paths = []string{s.Field}
+		written = paths
+	case TransformDefault:
+		if s.Value == nil {
+			return fmt.Errorf("\"value\" is required")
+		}
+		s.Value = utils.FromBSON(s.Value)
+		paths = []string{s.Field}
+		written = paths
+	case TransformSplit:
+		if s.Separator == "" {
+			return fmt.Errorf("\"separator\" is required")
+		}
+		if len(s.Into) == 0 {
+			return fmt.Errorf("\"into\" needs at least one field")
+		}
+		paths = append([]string{s.Field}, s.Into...)
+		written = s.Into
+	case TransformConcat:
+		if len(s.Fields) == 0 {
+			return fmt.Errorf("\"fields\" needs at least one field")
+		}
+		if s.To == "" {
+			return fmt.Errorf("\"to\" is required")
+		}
+		paths = append(append([]string{}, s.Fields...), s.To)
+		written = []string{s.To}
+	case TransformCompute:
+		if s.Expression == "" {
+			return fmt.Errorf("\"expression\" is required")
+		}
+		expr, err := parseExpression(s.Expression)
+		if err != nil {
+			return fmt.Errorf("invalid expression: %v", err)
+		}
+		s.expr = expr
+		paths = []string{s.Field}
+		written = paths
+	default:
+		return fmt.Errorf("unknown op %q", s.Op)
+	}
+
+	for _, path := range paths {
+		if path == "" {
+			return fmt.Errorf("\"field\" is required")
+		}
+		if err := utils.ValidateFieldPath(path); err != nil {
+			return err
+		}
+	}
+	for _, path := range written {
+		if strings.HasSuffix(path, "]") {
+			return fmt.Errorf("field %q must end with a key, not an array index", path)
+		}
+	}
+	return nil
+}
+
+// Apply runs the transforms in order on a parsed record, changing it in place.
+// The first failing transform stops the pipeline.
+func (p *TransformPipeline) Apply(data map[string]interface{}) *models.RecordError {
+	if p == nil {
+		return nil
+	}
+	for i, step := range p.steps {
+		if err := step.apply(data); err != nil {
+			field := step.Field
+			if step.Op == TransformConcat {
+				field = step.To
+			}
+			return models.NewRecordError(models.ErrorTransformFailed, field,
+				fmt.Sprintf("Transform %d (%s) failed: %v", i+1, step.Op, err))
+		}
+	}
+	return nil
+}
+
+func (s transformStep) apply(data map[string]interface{}) error {
+	switch s.Op {
+	case TransformRename:
+		value, ok := utils.LookupFieldPath(data, s.Field)
+		if !ok {
+			return nil
+		}
+		utils.DeleteFieldPath(data, s.Field)
+		return setField(data, s.To, value)
+	case TransformCast:
+		value, ok := utils.LookupFieldPath(data, s.Field)
+		if !ok || value == nil {
+			return nil
+		}
+		converted, err := castValue(value, ColumnType(s.Type))
+		if err != nil {
+			return err
+		}
+		return setField(data, s.Field, converted)
+	case TransformDrop:
+		utils.DeleteFieldPath(data, s.Field)
+	case TransformDefault:
+		if value, ok := utils.LookupFieldPath(data, s.Field); ok && value != nil {
+			return nil
+		}
+		return setField(data, s.Field, utils.FromBSON(s.Value))
+	case TransformSplit:
+		value, ok := utils.LookupFieldPath(data, s.Field)
+		if !ok || value == nil {
+			return nil
+		}
+		text, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("field %q is not a string", s.Field)
+		}
+		parts := strings.SplitN(text, s.Separator, len(s.Into))
+		for i, into := range s.Into {
+			var part interface{}
+			if i < len(parts) {
+				part = strings.TrimSpace(parts[i])
+			}
+			if err := setField(data, into, part); err != nil {
+				return err
+			}
+		}
+	case TransformConcat:
+		var parts []string
+		for _, field := range s.Fields {
+			value, ok := utils.LookupFieldPath(data, field)
+			if !ok || value == nil {
+				continue
+			}
+			text, err := castValue(value, ColumnString)
+			if err != nil {
+				return err
+			}
+			parts = append(parts, text.(string))
+		}
+		return setField(data, s.To, strings.Join(parts, s.Separator))
+	case TransformCompute:
+		result, err := s.expr.eval(data)
+		if err != nil {
+			return err
+		}
+		return setField(data, s.Field, result.value())
+	}
+	return nil
+}
+
+// setField stores value at path, replacing whatever is there. Written paths always end
+// with a key, see compile.
+func setField(data map[string]interface{}, path string, value interface{}) error {
+	utils.DeleteFieldPath(data, path)
+	return utils.SetNestedValue(data, path, value)
+}
+
+// castValue converts a field value to the given type. Text is converted like a CSV cell,
+// except that leading zeros are accepted since the cast was asked for explicitly.
+func castValue(value interface{}, t ColumnType) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		text := strings.TrimSpace(v)
+		switch {
+		case t == ColumnString:
+			return v, nil
+		case text == "":
+			return nil, nil
+		}
+		switch t {
+		case ColumnInt:
+			n, err := strconv.ParseInt(text, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid int value %q", v)
+			}
+			return n, nil
+		case ColumnFloat:
+			f, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid float value %q", v)
+			}
+			return f, nil
+		}
+		return convertCell(text, t)
+	case int64, int32, int, float64:
+		f, _ := toNumber(v)
+		switch t {
+		case ColumnString:
+			if f.isInt {
+				return strconv.FormatInt(f.i, 10), nil
+			}
+			return strconv.FormatFloat(f.f, 'f', -1, 64), nil
+		case ColumnInt:
+			if f.isInt {
+				return f.i, nil
+			}
+			if f.f != math.Trunc(f.f) {
+				return nil, fmt.Errorf("%v is not a whole number", f.f)
+			}
+			// float64(math.MaxInt64) rounds up to 2^63, which does not fit
+			if math.Abs(f.f) >= math.MaxInt64 {
+				return nil, fmt.Errorf("%v is out of range for int", f.f)
+			}
+			return int64(f.f), nil
+		case ColumnFloat:
+			return f.float(), nil
+		}
+	case bool:
+		switch t {
+		case ColumnBool:
+			return v, nil
+		case ColumnString:
+			return strconv.FormatBool(v), nil
+		}
+	case time.Time:
+		switch t {
+		case ColumnDate:
+			return v, nil
+		case ColumnString:
+			return v.Format(time.RFC3339Nano), nil
+		}
+	}
+	return nil, fmt.Errorf("cannot cast %v to %s", value, t)
+}
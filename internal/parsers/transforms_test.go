@@ -0,0 +1,52 @@
+package parsers
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCastValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   interface{}
+		t       ColumnType
+		want    interface{}
+		wantErr bool
+	}{
+		{name: "text to int", value: " 042 ", t: ColumnInt, want: int64(42)},
+		{name: "empty text", value: " ", t: ColumnInt, want: nil},
+		{name: "text to float", value: "1.5", t: ColumnFloat, want: 1.5},
+		{name: "text kept as string", value: " a ", t: ColumnString, want: " a "},
+		{name: "text to bool", value: "TRUE", t: ColumnBool, want: true},
+		{name: "whole float to int", value: 3.0, t: ColumnInt, want: int64(3)},
+		{name: "fractional float to int", value: 3.5, t: ColumnInt, wantErr: true},
+		{name: "largest float below 2^63", value: math.Nextafter(1<<63, 0), t: ColumnInt, want: int64(1<<63 - 1024)},
+		{name: "2^63", value: float64(1 << 63), t: ColumnInt, wantErr: true},
+		{name: "-2^63", value: -float64(1 << 63), t: ColumnInt, wantErr: true},
+		{name: "int to string", value: int64(7), t: ColumnString, want: "7"},
+		{name: "float to string", value: 0.25, t: ColumnString, want: "0.25"},
+		{name: "int to float", value: int64(2), t: ColumnFloat, want: 2.0},
+		{name: "bool to string", value: false, t: ColumnString, want: "false"},
+		{name: "date to string", value: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), t: ColumnString, want: "2024-01-02T00:00:00Z"},
+		{name: "bool to int", value: true, t: ColumnInt, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := castValue(tt.value, tt.t)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("castValue(%v, %s) = %#v, want an error", tt.value, tt.t, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("castValue(%v, %s): %v", tt.value, tt.t, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("castValue(%v, %s) = %#v, want %#v", tt.value, tt.t, got, tt.want)
+			}
+		})
+	}
+}
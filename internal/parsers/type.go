@@ -3,25 +3,123 @@ package parsers
 import (
 	"context"
 	"io"
-	"net/http"
-	"strings"
 
-	"github.com/vd09-projects/my-documentdb-system/internal/db"
+	"github.com/vd09-projects/my-documentdb-system/internal/models"
+	"github.com/vd09-projects/my-documentdb-system/internal/utils"
 )
 
 type Parser interface {
-	Parse(ctx context.Context, file io.Reader, w http.ResponseWriter, userID string, recordType string)
+	Parse(ctx context.Context, file io.Reader, opts ParseOptions) (*ParseResult, error)
 }
 
-func GetParser(fileName string, database db.Database) Parser {
-	if strings.HasSuffix(fileName, ".csv") {
-		return &CSVParser{
-			database: database,
+// ParseOptions carries the owner of an upload plus the format specific settings.
+// Settings that do not apply to the selected parser are ignored.
+type ParseOptions struct {
+	UserID     string
+	RecordType string
+	// BatchID, FileName and UploadedBy are stamped on every stored record together with its row.
+	// Records are stored without provenance when BatchID is empty.
+	BatchID    string
+	FileName   string
+	UploadedBy string
+	// Entry is the archive entry being parsed, stamped alongside FileName; ZIPParser sets it.
+	Entry string
+	// Schemas holds the current compiled JSON Schema of each record type that has one.
+	Schemas map[string]*utils.VersionedSchema
+	// NaturalKeys holds the natural key fields of each record type that has one.
+	NaturalKeys map[string][]string
+	// Transforms holds the transform pipeline of each record type that has one.
+	Transforms map[string]*TransformPipeline
+	// EventTimes holds the event time setting of each record type that has one.
+	EventTimes map[string]*models.EventTime
+
+	// ColumnTypes fixes the type of the named CSV columns; the others are inferred from the data.
+	ColumnTypes map[string]ColumnType
+	// CSVDialect sets the delimiter, quoting, encoding and header layout of CSV files.
+	CSVDialect models.CSVDialect
+	// Sheet selects the XLSX sheet to ingest; the first sheet is used when empty.
+	Sheet string
+	// SheetRecordTypes maps XLSX sheet names to record types so several sheets can be ingested at once.
+	// When set, it takes precedence over Sheet and RecordType.
+	SheetRecordTypes map[string]string
+	// RecordElement is the name of the XML element holding one record, e.g. "order".
+	// Every direct child of the root element is treated as a record when empty.
+	RecordElement string
+	// EntryRecordTypes maps the entries of a ZIP archive, by path or base name, to record types.
+	// Entries it does not name use RecordType, or are skipped when RecordType is empty.
+	EntryRecordTypes map[string]string
+}
+
+// maxRowErrors caps the per-row errors kept in a ParseResult; the counts stay exact.
+const maxRowErrors = 1000
+
+// ParseResult summarises one parse run.
+type ParseResult struct {
+	Inserted    int        `json:"inserted"`
+	Quarantined int        `json:"quarantined"`
+	Errors      []RowError `json:"errors"`
+	// Fields lists the field paths found in the inserted records, as stored in record_fields.
+	Fields []string `json:"fields"`
+	// Skipped lists the entries of a ZIP archive that were not ingested.
+	Skipped []SkippedEntry `json:"skipped,omitempty"`
+
+	fieldSet map[string]struct{}
+}
+
+// RowError describes why one row was quarantined. Row is the 1-based position of the record
+// in the file: the line it starts on for CSV and NDJSON, the element for JSON arrays,
+// the sheet row for XLSX and the record element for XML. Entry names the archive entry
+// holding the record in a ZIP upload.
+type RowError struct {
+	Entry string `json:"entry,omitempty"`
+	Row   int    `json:"row"`
+	models.RecordError
+}
+
+// SkippedEntry is an entry of a ZIP archive that was not ingested, and why.
+type SkippedEntry struct {
+	Entry  string `json:"entry"`
+	Reason string `json:"reason"`
+}
+
+func newParseResult() *ParseResult {
+	return &ParseResult{
+		Errors:   []RowError{},
+		Fields:   []string{},
+		fieldSet: make(map[string]struct{}),
+	}
+}
+
+func (r *ParseResult) addError(row int, recordErr models.RecordError) {
+	r.Quarantined++
+	if len(r.Errors) < maxRowErrors {
+		r.Errors = append(r.Errors, RowError{Row: row, RecordError: recordErr})
+	}
+}
+
+func (r *ParseResult) skip(entry, reason string) {
+	r.Skipped = append(r.Skipped, SkippedEntry{Entry: entry, Reason: reason})
+}
+
+// merge adds the outcome of parsing one archive entry.
+func (r *ParseResult) merge(entry string, other *ParseResult) {
+	r.Inserted += other.Inserted
+	r.Quarantined += other.Quarantined
+	for _, rowErr := range other.Errors {
+		if len(r.Errors) == maxRowErrors {
+			break
 		}
-	} else if strings.HasSuffix(fileName, ".json") {
-		return &JSONParser{
-			database: database,
+		rowErr.Entry = entry
+		r.Errors = append(r.Errors, rowErr)
+	}
+	r.addFields(other.Fields)
+}
+
+func (r *ParseResult) addFields(fields []string) {
+	for _, field := range fields {
+		if _, seen := r.fieldSet[field]; !seen {
+			r.fieldSet[field] = struct{}{}
+			r.Fields = append(r.Fields, field)
 		}
 	}
-	return nil
 }
@@ -0,0 +1,245 @@
+package parsers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/vd09-projects/my-documentdb-system/internal/db"
+	"github.com/xuri/excelize/v2"
+)
+
+// XLSXParser reads Excel workbooks, using the first row of a sheet as headers like CSVParser.
+// ParseOptions.Sheet and ParseOptions.SheetRecordTypes select the sheets to ingest.
+type XLSXParser struct {
+	database db.Database
+}
+
+func init() {
+	Register(Format{
+		Name:       "xlsx",
+		MIMETypes:  []string{"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+		Extensions: []string{".xlsx"},
+		Sniff:      sniffXLSX,
+		New: func(database db.Database) Parser {
+			return &XLSXParser{database: database}
+		},
+	})
+}
+
+// sniffXLSX recognises a workbook: a ZIP archive whose first entries describe the spreadsheet parts.
+func sniffXLSX(head []byte) bool {
+	return bytes.HasPrefix(head, []byte("PK\x03\x04")) &&
+		(bytes.Contains(head, []byte("[Content_Types].xml")) || bytes.Contains(head, []byte("xl/")))
+}
+
+func (p *XLSXParser) Parse(ctx context.Context, file io.Reader, opts ParseOptions) (*ParseResult, error) {
+	f, err := excelize.OpenReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read XLSX file: %w", err)
+	}
+	defer f.Close()
+
+	sheetTypes, err := sheetRecordTypes(f, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := newParseResult()
+	for _, sheet := range f.GetSheetList() {
+		sheetRecordType, ok := sheetTypes[sheet]
+		if !ok {
+			continue
+		}
+		sink := newRecordSink(ctx, p.database, opts, sheetRecordType, result)
+		if err := parseSheet(f, sheet, sink); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// sheetRecordTypes resolves which sheets to ingest and the record type for each of them.
+func sheetRecordTypes(f *excelize.File, opts ParseOptions) (map[string]string, error) {
+	sheets := f.GetSheetList()
+	if len(sheets) == 0 {
+		return nil, fmt.Errorf("workbook has no sheets")
+	}
+
+	exists := func(name string) bool {
+		for _, sheet := range sheets {
+			if sheet == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(opts.SheetRecordTypes) > 0 {
+		for sheet, sheetRecordType := range opts.SheetRecordTypes {
+			if !exists(sheet) {
+				return nil, fmt.Errorf("sheet %q not found", sheet)
+			}
+			if sheetRecordType == "" {
+				return nil, fmt.Errorf("missing record type for sheet %q", sheet)
+			}
+		}
+		return opts.SheetRecordTypes, nil
+	}
+
+	if opts.RecordType == "" {
+		return nil, fmt.Errorf("record type is required")
+	}
+
+	sheet := opts.Sheet
+	if sheet == "" {
+		sheet = sheets[0]
+	} else if !exists(sheet) {
+		return nil, fmt.Errorf("sheet %q not found", sheet)
+	}
+	return map[string]string{sheet: opts.RecordType}, nil
+}
+
+func parseSheet(f *excelize.File, sheet string, sink *recordSink) error {
+	// Raw values keep numbers and dates unformatted; cellValue converts them back to typed values
+	rows, err := f.GetRows(sheet, excelize.Options{RawCellValue: true})
+	if err != nil {
+		return fmt.Errorf("failed to read sheet %q: %w", sheet, err)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	props, err := f.GetWorkbookProps()
+	if err != nil {
+		return fmt.Errorf("failed to read workbook properties: %w", err)
+	}
+	date1904 := props.Date1904 != nil && *props.Date1904
+
+	cells := &xlsxCellReader{f: f, sheet: sheet, date1904: date1904, dateStyles: map[int]bool{}}
+	headers := rows[0]
+
+	for rowIdx := 1; rowIdx < len(rows); rowIdx++ {
+		record := rows[rowIdx]
+		rowNum := rowIdx + 1
+		// Blank rows are common at the end of a sheet and carry no data
+		if len(strings.Join(record, "")) == 0 {
+			continue
+		}
+
+		// GetRows drops trailing empty cells, so only longer rows are a mismatch
+		if len(record) > len(headers) {
+			if err := sink.Quarantine(rowNum, record, columnCountError(len(record), len(headers))); err != nil {
+				return err
+			}
+			continue
+		}
+
+		data := make(map[string]interface{}, len(headers))
+		for colIdx, key := range headers {
+			raw := ""
+			if colIdx < len(record) {
+				raw = record[colIdx]
+			}
+			data[key] = cells.value(colIdx, rowIdx, raw)
+		}
+
+		if err := sink.Add(rowNum, data, record); err != nil {
+			return err
+		}
+	}
+
+	return sink.Flush()
+}
+
+// xlsxCellReader converts raw cell values of one sheet into numbers, booleans and dates.
+type xlsxCellReader struct {
+	f          *excelize.File
+	sheet      string
+	date1904   bool
+	dateStyles map[int]bool
+}
+
+func (c *xlsxCellReader) value(colIdx, rowIdx int, raw string) interface{} {
+	if raw == "" {
+		return raw
+	}
+
+	cell, err := excelize.CoordinatesToCellName(colIdx+1, rowIdx+1)
+	if err != nil {
+		return raw
+	}
+	cellType, err := c.f.GetCellType(c.sheet, cell)
+	if err != nil {
+		return raw
+	}
+
+	switch cellType {
+	case excelize.CellTypeBool:
+		return raw == "1" || strings.EqualFold(raw, "true")
+	case excelize.CellTypeUnset, excelize.CellTypeNumber:
+		num, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return raw
+		}
+		if c.isDateCell(cell) {
+			if t, err := excelize.ExcelDateToTime(num, c.date1904); err == nil {
+				return t
+			}
+		}
+		return num
+	}
+	return raw
+}
+
+// isDateCell reports whether the number format applied to the cell renders a date or time.
+func (c *xlsxCellReader) isDateCell(cell string) bool {
+	styleID, err := c.f.GetCellStyle(c.sheet, cell)
+	if err != nil {
+		return false
+	}
+	if isDate, ok := c.dateStyles[styleID]; ok {
+		return isDate
+	}
+
+	isDate := false
+	if style, err := c.f.GetStyle(styleID); err == nil {
+		if style.CustomNumFmt != nil {
+			isDate = isDateFormatCode(*style.CustomNumFmt)
+		} else {
+			isDate = isBuiltInDateFormat(style.NumFmt)
+		}
+	}
+	c.dateStyles[styleID] = isDate
+	return isDate
+}
+
+// isBuiltInDateFormat reports whether a built-in number format ID is a date or time format.
+func isBuiltInDateFormat(numFmt int) bool {
+	return (numFmt >= 14 && numFmt <= 22) || (numFmt >= 27 && numFmt <= 36) ||
+		(numFmt >= 45 && numFmt <= 47) || (numFmt >= 50 && numFmt <= 58)
+}
+
+// isDateFormatCode reports whether a custom number format contains date or time tokens,
+// ignoring quoted literals and bracketed sections such as colors.
+func isDateFormatCode(code string) bool {
+	inQuote, inBracket := false, false
+	for _, r := range strings.ToLower(code) {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+		case inQuote:
+		case r == '[':
+			inBracket = true
+		case r == ']':
+			inBracket = false
+		case inBracket:
+		case strings.ContainsRune("ymdhs", r):
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+package parsers
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/vd09-projects/my-documentdb-system/internal/db"
+	"github.com/vd09-projects/my-documentdb-system/internal/models"
+)
+
+// XMLParser streams an XML feed and stores every record element as a nested map.
+// Attributes are stored with an "@" prefix, repeated child elements become arrays
+// and the text of an element that also has attributes or children is kept under "#text".
+// The record element is set with ParseOptions.RecordElement.
+type XMLParser struct {
+	database db.Database
+}
+
+func init() {
+	Register(Format{
+		Name:       "xml",
+		MIMETypes:  []string{"application/xml", "text/xml"},
+		Extensions: []string{".xml"},
+		Sniff: func(head []byte) bool {
+			head = trimHead(head)
+			return len(head) > 0 && head[0] == '<'
+		},
+		New: func(database db.Database) Parser {
+			return &XMLParser{database: database}
+		},
+	})
+}
+
+func (p *XMLParser) Parse(ctx context.Context, file io.Reader, opts ParseOptions) (*ParseResult, error) {
+	decoder := xml.NewDecoder(file)
+
+	result := newParseResult()
+	sink := newRecordSink(ctx, p.database, opts, opts.RecordType, result)
+	depth := 0
+	recordNum := 0
+
+tokens:
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// The decoder cannot recover from a syntax error, so keep what was stored so far
+			if err := sink.Quarantine(recordNum+1, err.Error(), models.RecordError{Code: models.ErrorInvalidXML, Reason: "Invalid XML structure"}); err != nil {
+				return nil, err
+			}
+			break
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if !isRecordElement(t, depth, opts.RecordElement) {
+				continue
+			}
+
+			recordNum++
+			rec, err := decodeXMLElement(decoder, t)
+			depth--
+			if err != nil {
+				if err := sink.Quarantine(recordNum, err.Error(), models.RecordError{Code: models.ErrorInvalidXML, Reason: "Invalid XML structure"}); err != nil {
+					return nil, err
+				}
+				break tokens
+			}
+
+			if err := sink.Add(recordNum, rec, rec); err != nil {
+				return nil, err
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+
+	if err := sink.Flush(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// isRecordElement reports whether start holds one record. Without a configured
+// record element every direct child of the root element is a record.
+func isRecordElement(start xml.StartElement, depth int, recordElement string) bool {
+	if recordElement == "" {
+		return depth == 2
+	}
+	return start.Name.Local == recordElement
+}
+
+// decodeXMLElement reads the content of start up to its matching end element.
+func decodeXMLElement(decoder *xml.Decoder, start xml.StartElement) (map[string]interface{}, error) {
+	node := make(map[string]interface{})
+	for _, attr := range start.Attr {
+		if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+			continue
+		}
+		node["@"+attr.Name.Local] = attr.Value
+	}
+
+	var text strings.Builder
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			return nil, fmt.Errorf("unexpected end of file inside <%s>", start.Name.Local)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			child, err := decodeXMLElement(decoder, t)
+			if err != nil {
+				return nil, err
+			}
+			addXMLChild(node, t.Name.Local, simplifyXMLNode(child))
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if content := strings.TrimSpace(text.String()); content != "" {
+				node["#text"] = content
+			}
+			return node, nil
+		}
+	}
+}
+
+// simplifyXMLNode collapses an element that only holds text into a plain string.
+func simplifyXMLNode(node map[string]interface{}) interface{} {
+	switch len(node) {
+	case 0:
+		return ""
+	case 1:
+		if text, ok := node["#text"]; ok {
+			return text
+		}
+	}
+	return node
+}
+
+// addXMLChild stores a child value, turning repeated element names into an array.
+func addXMLChild(node map[string]interface{}, name string, value interface{}) {
+	existing, ok := node[name]
+	if !ok {
+		node[name] = value
+		return
+	}
+	if list, isList := existing.([]interface{}); isList {
+		node[name] = append(list, value)
+		return
+	}
+	node[name] = []interface{}{existing, value}
+}
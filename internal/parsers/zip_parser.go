@@ -0,0 +1,158 @@
+package parsers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/vd09-projects/my-documentdb-system/internal/db"
+)
+
+const zipFormat = "zip"
+
+// ZIPParser ingests each file of a ZIP archive with the parser chosen for its name, see Detect.
+// ParseOptions.EntryRecordTypes and ParseOptions.RecordType give the record type of each entry.
+type ZIPParser struct {
+	database db.Database
+}
+
+func init() {
+	Register(Format{
+		Name:       zipFormat,
+		MIMETypes:  []string{"application/zip", "application/x-zip-compressed"},
+		Extensions: []string{".zip"},
+		// XLSX workbooks are ZIP archives too, but are recognised by their own probe
+		Sniff: func(head []byte) bool {
+			return bytes.HasPrefix(head, []byte("PK\x03\x04")) && !sniffXLSX(head)
+		},
+		New: func(database db.Database) Parser {
+			return &ZIPParser{database: database}
+		},
+	})
+}
+
+func (p *ZIPParser) Parse(ctx context.Context, file io.Reader, opts ParseOptions) (*ParseResult, error) {
+	// The central directory is at the end of the archive, so it is spooled to disk first
+	spool, err := os.CreateTemp("", "upload-*.zip")
+	if err != nil {
+		return nil, fmt.Errorf("failed to buffer ZIP file: %w", err)
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	size, err := io.Copy(spool, file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to buffer ZIP file: %w", err)
+	}
+	archive, err := zip.NewReader(spool, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ZIP file: %w", err)
+	}
+
+	entries := make([]*zip.File, 0, len(archive.File))
+	for _, entry := range archive.File {
+		if !ignoredEntry(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+
+	for name, entryRecordType := range opts.EntryRecordTypes {
+		if !entryExists(entries, name) {
+			return nil, fmt.Errorf("entry %q not found", name)
+		}
+		if entryRecordType == "" {
+			return nil, fmt.Errorf("missing record type for entry %q", name)
+		}
+	}
+
+	result := newParseResult()
+	ingested := 0
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		recordType := entryRecordType(entry.Name, opts)
+		if recordType == "" {
+			result.skip(entry.Name, "no record type for entry")
+			continue
+		}
+
+		entryResult, skipReason, err := p.parseEntry(ctx, entry, recordType, opts)
+		if err != nil {
+			return nil, fmt.Errorf("entry %q: %w", entry.Name, err)
+		}
+		if skipReason != "" {
+			result.skip(entry.Name, skipReason)
+			continue
+		}
+		result.merge(entry.Name, entryResult)
+		ingested++
+	}
+	if ingested == 0 {
+		return nil, fmt.Errorf("ZIP file has no entries to ingest")
+	}
+	return result, nil
+}
+
+// parseEntry ingests one entry. It returns a reason instead when the entry cannot be ingested.
+func (p *ZIPParser) parseEntry(ctx context.Context, entry *zip.File, recordType string, opts ParseOptions) (*ParseResult, string, error) {
+	rc, err := entry.Open()
+	if err != nil {
+		return nil, "", err
+	}
+	defer rc.Close()
+
+	format, content, ok, err := Detect(entry.Name, "", rc)
+	if err != nil {
+		return nil, "", err
+	}
+	if !ok {
+		return nil, "unsupported file type", nil
+	}
+	if format.Name == zipFormat {
+		return nil, "nested ZIP files are not supported", nil
+	}
+
+	entryOpts := opts
+	entryOpts.RecordType = recordType
+	entryOpts.Entry = entry.Name
+	entryOpts.SheetRecordTypes = nil
+	result, err := format.New(p.database).Parse(ctx, content, entryOpts)
+	return result, "", err
+}
+
+// ignoredEntry reports whether an entry is a directory or file system metadata, such as the
+// __MACOSX folder and dot files added by archivers.
+func ignoredEntry(entry *zip.File) bool {
+	if entry.FileInfo().IsDir() || strings.HasPrefix(entry.Name, "__MACOSX/") {
+		return true
+	}
+	return strings.HasPrefix(path.Base(entry.Name), ".")
+}
+
+func entryExists(entries []*zip.File, name string) bool {
+	for _, entry := range entries {
+		if entry.Name == name || path.Base(entry.Name) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// entryRecordType returns the record type of an entry, matching EntryRecordTypes by path, then by base name.
+func entryRecordType(name string, opts ParseOptions) string {
+	if recordType, ok := opts.EntryRecordTypes[name]; ok {
+		return recordType
+	}
+	if recordType, ok := opts.EntryRecordTypes[path.Base(name)]; ok {
+		return recordType
+	}
+	return opts.RecordType
+}
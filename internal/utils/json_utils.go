@@ -3,10 +3,13 @@ package utils
 import (
 	"encoding/json"
 	"fmt"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // TraverseDynamicJSON processes a JSON object of type `interface{}` to extract field paths, treating arrays as a single field.
@@ -143,3 +146,279 @@ func traverseMap(data interface{}, path string) ([]float64, bool) {
 	// Extract float64 values from the collected data
 	return extractFloatValues(collected), true
 }
+
+// pathToken is one step of a field path: either a map key or an array index.
+type pathToken struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// maxPathIndex bounds array indexes in field paths so a header cannot allocate huge arrays.
+const maxPathIndex = 10000
+
+// parseFieldPath splits a path such as "purchases[0].price" into keys and indexes.
+func parseFieldPath(path string) ([]pathToken, error) {
+	var tokens []pathToken
+	for _, segment := range strings.Split(path, ".") {
+		key := segment
+		var indexes []int
+		if open := strings.Index(segment, "["); open >= 0 {
+			key = segment[:open]
+			rest := segment[open:]
+			for rest != "" {
+				end := strings.Index(rest, "]")
+				if rest[0] != '[' || end < 0 {
+					return nil, fmt.Errorf("invalid field path %q", path)
+				}
+				index, err := strconv.Atoi(rest[1:end])
+				if err != nil || index < 0 || index > maxPathIndex {
+					return nil, fmt.Errorf("invalid array index in field path %q", path)
+				}
+				indexes = append(indexes, index)
+				rest = rest[end+1:]
+			}
+		}
+
+		if key == "" {
+			return nil, fmt.Errorf("empty key in field path %q", path)
+		}
+		tokens = append(tokens, pathToken{key: key})
+		for _, index := range indexes {
+			tokens = append(tokens, pathToken{index: index, isIndex: true})
+		}
+	}
+	return tokens, nil
+}
+
+// SetNestedValue stores value in data under a dotted path, creating nested maps for keys
+// and arrays for "[n]" indexes, e.g. "address.city" or "purchases[0].price".
+func SetNestedValue(data map[string]interface{}, path string, value interface{}) error {
+	tokens, err := parseFieldPath(path)
+	if err != nil {
+		return err
+	}
+
+	var set func(current interface{}, tokens []pathToken) (interface{}, error)
+	set = func(current interface{}, tokens []pathToken) (interface{}, error) {
+		if len(tokens) == 0 {
+			if current != nil {
+				return nil, fmt.Errorf("field path %q conflicts with another field", path)
+			}
+			return value, nil
+		}
+
+		tok := tokens[0]
+		if tok.isIndex {
+			list, ok := current.([]interface{})
+			if current != nil && !ok {
+				return nil, fmt.Errorf("field path %q conflicts with another field", path)
+			}
+			for len(list) <= tok.index {
+				list = append(list, nil)
+			}
+			child, err := set(list[tok.index], tokens[1:])
+			if err != nil {
+				return nil, err
+			}
+			list[tok.index] = child
+			return list, nil
+		}
+
+		m, ok := current.(map[string]interface{})
+		if current != nil && !ok {
+			return nil, fmt.Errorf("field path %q conflicts with another field", path)
+		}
+		if m == nil {
+			m = make(map[string]interface{})
+		}
+		child, err := set(m[tok.key], tokens[1:])
+		if err != nil {
+			return nil, err
+		}
+		m[tok.key] = child
+		return m, nil
+	}
+
+	_, err = set(data, tokens)
+	return err
+}
+
+// IsArrayFieldPath reports whether a field path addresses an array element.
+func IsArrayFieldPath(path string) bool {
+	return strings.Contains(path, "[")
+}
+
+// JSONChange is one difference between two JSON documents.
+type JSONChange struct {
+	// Path is the RFC 6901 JSON pointer of the changed value.
+	Path   string      `json:"path"`
+	Change string      `json:"change"` // "added", "removed" or "changed"
+	From   interface{} `json:"from,omitempty"`
+	To     interface{} `json:"to,omitempty"`
+}
+
+// DiffJSON lists the differences between two decoded JSON documents, walking objects by key
+// and arrays by index. Object keys are visited in sorted order so the result is stable.
+func DiffJSON(from, to interface{}) []JSONChange {
+	changes := []JSONChange{}
+	diffJSONValue(nil, from, to, &changes)
+	return changes
+}
+
+func diffJSONValue(location []string, from, to interface{}, changes *[]JSONChange) {
+	switch fromVal := from.(type) {
+	case map[string]interface{}:
+		if toVal, ok := to.(map[string]interface{}); ok {
+			keys := make([]string, 0, len(fromVal)+len(toVal))
+			for k := range fromVal {
+				keys = append(keys, k)
+			}
+			for k := range toVal {
+				if _, ok := fromVal[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				child := append(append([]string{}, location...), k)
+				fromChild, inFrom := fromVal[k]
+				toChild, inTo := toVal[k]
+				switch {
+				case !inFrom:
+					*changes = append(*changes, JSONChange{Path: jsonPointer(child), Change: "added", To: toChild})
+				case !inTo:
+					*changes = append(*changes, JSONChange{Path: jsonPointer(child), Change: "removed", From: fromChild})
+				default:
+					diffJSONValue(child, fromChild, toChild, changes)
+				}
+			}
+			return
+		}
+	case []interface{}:
+		if toVal, ok := to.([]interface{}); ok {
+			for i := 0; i < len(fromVal) || i < len(toVal); i++ {
+				child := append(append([]string{}, location...), strconv.Itoa(i))
+				switch {
+				case i >= len(fromVal):
+					*changes = append(*changes, JSONChange{Path: jsonPointer(child), Change: "added", To: toVal[i]})
+				case i >= len(toVal):
+					*changes = append(*changes, JSONChange{Path: jsonPointer(child), Change: "removed", From: fromVal[i]})
+				default:
+					diffJSONValue(child, fromVal[i], toVal[i], changes)
+				}
+			}
+			return
+		}
+	}
+
+	if !reflect.DeepEqual(from, to) {
+		*changes = append(*changes, JSONChange{Path: jsonPointer(location), Change: "changed", From: from, To: to})
+	}
+}
+
+// FromBSON converts a value decoded from MongoDB into the plain maps and slices the parsers
+// produce, so stored records can go through the same validation and field tracking.
+func FromBSON(v interface{}) interface{} {
+	switch val := v.(type) {
+	case bson.M:
+		return FromBSON(map[string]interface{}(val))
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			out[k] = FromBSON(item)
+		}
+		return out
+	case bson.D:
+		out := make(map[string]interface{}, len(val))
+		for _, elem := range val {
+			out[elem.Key] = FromBSON(elem.Value)
+		}
+		return out
+	case bson.A:
+		return FromBSON([]interface{}(val))
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = FromBSON(item)
+		}
+		return out
+	case primitive.DateTime:
+		return val.Time()
+	default:
+		return val
+	}
+}
+
+// ValidateFieldPath checks that a field path such as "customer.id" or "items[0].sku" is well formed.
+func ValidateFieldPath(path string) error {
+	_, err := parseFieldPath(path)
+	return err
+}
+
+// LookupFieldPath returns the value at a field path, or false if the path is missing.
+func LookupFieldPath(data map[string]interface{}, path string) (interface{}, bool) {
+	tokens, err := parseFieldPath(path)
+	if err != nil {
+		return nil, false
+	}
+
+	var current interface{} = data
+	for _, tok := range tokens {
+		if tok.isIndex {
+			list, ok := current.([]interface{})
+			if !ok || tok.index >= len(list) {
+				return nil, false
+			}
+			current = list[tok.index]
+			continue
+		}
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[tok.key]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// DeleteFieldPath removes the value at a field path ending in a key and reports whether it was there.
+func DeleteFieldPath(data map[string]interface{}, path string) bool {
+	tokens, err := parseFieldPath(path)
+	if err != nil {
+		return false
+	}
+	last := tokens[len(tokens)-1]
+	if last.isIndex {
+		return false
+	}
+
+	var current interface{} = data
+	for _, tok := range tokens[:len(tokens)-1] {
+		if tok.isIndex {
+			list, ok := current.([]interface{})
+			if !ok || tok.index >= len(list) {
+				return false
+			}
+			current = list[tok.index]
+			continue
+		}
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		current = m[tok.key]
+	}
+
+	m, ok := current.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	if _, ok := m[last.key]; !ok {
+		return false
+	}
+	delete(m, last.key)
+	return true
+}
@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vd09-projects/my-documentdb-system/internal/models"
+)
+
+// DateLayouts are the date formats recognised in text values, most specific first.
+var DateLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// NaturalKey builds the identity of a record from the values at the given field paths.
+// The values are encoded as a JSON array of their text, so a key matches whether a CSV column
+// was inferred as a number, bool or date in one upload and kept as text in another. A record
+// missing any of the fields, or holding null in one, has no natural key and is rejected.
+func NaturalKey(data map[string]interface{}, fields []string) (string, *models.RecordError) {
+	values := make([]interface{}, 0, len(fields))
+	for _, field := range fields {
+		value, ok := LookupFieldPath(data, field)
+		if !ok || value == nil {
+			return "", models.NewRecordError(models.ErrorMissingNaturalKey, field, fmt.Sprintf("Missing natural key field %q", field))
+		}
+		keyValue, err := naturalKeyValue(toJSONValue(value))
+		if err != nil {
+			return "", models.NewRecordError(models.ErrorMissingNaturalKey, field, fmt.Sprintf("Invalid natural key field %q: %v", field, err))
+		}
+		values = append(values, keyValue)
+	}
+
+	key, err := json.Marshal(values)
+	if err != nil {
+		return "", models.NewRecordError(models.ErrorMissingNaturalKey, "", fmt.Sprintf("Invalid natural key: %v", err))
+	}
+	return string(key), nil
+}
+
+// maxExactFloatInt is the largest magnitude up to which every integer is exact in a float64.
+const maxExactFloatInt = 1 << 53
+
+// naturalKeyValue renders a scalar key value as the text type inference would have read it
+// from, e.g. 5, 5.0 and "5" all become "5". Objects and arrays are kept as they are.
+// Text is only rewritten where that cannot make two different values equal.
+func naturalKeyValue(v interface{}) (interface{}, error) {
+	switch val := v.(type) {
+	case string:
+		return naturalKeyText(val), nil
+	case bool:
+		return strconv.FormatBool(val), nil
+	case int:
+		return strconv.FormatInt(int64(val), 10), nil
+	case int8:
+		return strconv.FormatInt(int64(val), 10), nil
+	case int16:
+		return strconv.FormatInt(int64(val), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(val), 10), nil
+	case int64:
+		return strconv.FormatInt(val, 10), nil
+	case uint:
+		return strconv.FormatUint(uint64(val), 10), nil
+	case uint8:
+		return strconv.FormatUint(uint64(val), 10), nil
+	case uint16:
+		return strconv.FormatUint(uint64(val), 10), nil
+	case uint32:
+		return strconv.FormatUint(uint64(val), 10), nil
+	case uint64:
+		return strconv.FormatUint(val, 10), nil
+	case float32:
+		return formatKeyFloat(float64(val))
+	case float64:
+		return formatKeyFloat(val)
+	}
+	return v, nil
+}
+
+// naturalKeyText normalises text that a CSV upload could have converted to another type.
+// Only plain integers are rewritten as numbers, e.g. "+5" becomes "5"; decimals, exponents and
+// integers too large for int64 are kept as written, as is any number with a leading zero,
+// which is a code rather than a number.
+func naturalKeyText(s string) string {
+	if isPlainInteger(s) {
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return strconv.FormatInt(n, 10)
+		}
+		return s
+	}
+	switch strings.ToLower(s) {
+	case "true", "false":
+		return strings.ToLower(s)
+	}
+	for _, layout := range DateLayouts {
+		if d, err := time.Parse(layout, s); err == nil {
+			return d.UTC().Format(time.RFC3339Nano)
+		}
+	}
+	return s
+}
+
+// isPlainInteger reports whether s is an optionally signed run of decimal digits without a
+// leading zero, e.g. "42" or "-7" but not "007" or "1e3".
+func isPlainInteger(s string) bool {
+	digits := strings.TrimLeft(s, "+-")
+	if len(digits) == 0 || len(s)-len(digits) > 1 || (len(digits) > 1 && digits[0] == '0') {
+		return false
+	}
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// formatKeyFloat writes a float in its shortest form. Integral values small enough to be exact
+// match the same integer; larger ones are written with an exponent, so they cannot match an
+// integer they were rounded from. NaN and infinities are rejected.
+func formatKeyFloat(f float64) (string, error) {
+	switch {
+	case math.IsNaN(f) || math.IsInf(f, 0):
+		return "", fmt.Errorf("%v is not a number", f)
+	case f != math.Trunc(f):
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	case math.Abs(f) <= maxExactFloatInt:
+		return strconv.FormatInt(int64(f), 10), nil
+	}
+	return strconv.FormatFloat(f, 'e', -1, 64), nil
+}
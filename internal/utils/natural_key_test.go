@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestNaturalKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   map[string]interface{}
+		fields []string
+		want   string
+	}{
+		{name: "inferred integer", data: map[string]interface{}{"id": int64(5)}, fields: []string{"id"}, want: `["5"]`},
+		{name: "integer text", data: map[string]interface{}{"id": "5"}, fields: []string{"id"}, want: `["5"]`},
+		{name: "integral float", data: map[string]interface{}{"id": 5.0}, fields: []string{"id"}, want: `["5"]`},
+		{name: "decimal", data: map[string]interface{}{"id": 1.5}, fields: []string{"id"}, want: `["1.5"]`},
+		{name: "decimal text", data: map[string]interface{}{"id": "1.5"}, fields: []string{"id"}, want: `["1.5"]`},
+		{name: "signed integer text", data: map[string]interface{}{"id": "+5"}, fields: []string{"id"}, want: `["5"]`},
+		{name: "large integer", data: map[string]interface{}{"id": int64(9007199254740993)}, fields: []string{"id"}, want: `["9007199254740993"]`},
+		{name: "large integer text", data: map[string]interface{}{"id": "9007199254740993"}, fields: []string{"id"}, want: `["9007199254740993"]`},
+		{name: "large integral float", data: map[string]interface{}{"id": float64(1 << 60)}, fields: []string{"id"}, want: `["1.152921504606847e+18"]`},
+		{name: "leading zero is kept", data: map[string]interface{}{"id": "007"}, fields: []string{"id"}, want: `["007"]`},
+		{name: "bool", data: map[string]interface{}{"ok": true}, fields: []string{"ok"}, want: `["true"]`},
+		{name: "bool text", data: map[string]interface{}{"ok": "TRUE"}, fields: []string{"ok"}, want: `["true"]`},
+		{name: "date", data: map[string]interface{}{"day": time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)}, fields: []string{"day"}, want: `["2024-01-02T00:00:00Z"]`},
+		{name: "date text", data: map[string]interface{}{"day": "2024-01-02"}, fields: []string{"day"}, want: `["2024-01-02T00:00:00Z"]`},
+		{name: "plain text", data: map[string]interface{}{"sku": "AB-1"}, fields: []string{"sku"}, want: `["AB-1"]`},
+		{
+			name:   "several fields in order",
+			data:   map[string]interface{}{"region": "eu", "order": map[string]interface{}{"id": int64(12)}},
+			fields: []string{"region", "order.id"},
+			want:   `["eu","12"]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, recordErr := NaturalKey(tt.data, tt.fields)
+			if recordErr != nil {
+				t.Fatalf("NaturalKey: %s", recordErr.Reason)
+			}
+			if got != tt.want {
+				t.Errorf("NaturalKey = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// Values that are not equal must never share a key
+func TestNaturalKeyCollisions(t *testing.T) {
+	pairs := [][2]interface{}{
+		{"1.10", "1.1"},
+		{"1.50", 1.5},
+		{"1e3", "1000"},
+		{"1e3", int64(1000)},
+		{"inf", "Infinity"},
+		{"007", "7"},
+		{"007", int64(7)},
+		{"-0.0", "0"},
+		{"99999999999999999999", 1e20},
+		{"9007199254740993", float64(9007199254740992)},
+		{int64(1<<60 + 1), float64(1 << 60)},
+		{int64(1152921504606847000), float64(1 << 60)},
+		{"0x10", int64(16)},
+	}
+	for _, pair := range pairs {
+		a, errA := NaturalKey(map[string]interface{}{"id": pair[0]}, []string{"id"})
+		b, errB := NaturalKey(map[string]interface{}{"id": pair[1]}, []string{"id"})
+		if errA != nil || errB != nil {
+			t.Fatalf("NaturalKey(%#v, %#v): %v, %v", pair[0], pair[1], errA, errB)
+		}
+		if a == b {
+			t.Errorf("%#v and %#v share the key %s", pair[0], pair[1], a)
+		}
+	}
+}
+
+func TestNaturalKeyNotANumber(t *testing.T) {
+	for _, value := range []float64{math.NaN(), math.Inf(1), math.Inf(-1)} {
+		if _, recordErr := NaturalKey(map[string]interface{}{"id": value}, []string{"id"}); recordErr == nil {
+			t.Errorf("NaturalKey(%v) succeeded, want an error", value)
+		}
+	}
+}
+
+func TestNaturalKeyMissingField(t *testing.T) {
+	for _, data := range []map[string]interface{}{{}, {"id": nil}} {
+		if _, recordErr := NaturalKey(data, []string{"id"}); recordErr == nil {
+			t.Errorf("NaturalKey(%v) succeeded, want an error", data)
+		}
+	}
+}
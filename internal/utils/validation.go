@@ -1,8 +1,168 @@
 package utils
 
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+	"github.com/vd09-projects/my-documentdb-system/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
 // IsValidRecord checks if the data meets minimal JSON criteria using generics
 func IsValidRecord[T any](rec map[string]T) bool {
 	// Example: Must have a "userId" field
 	_, ok := rec["userId"]
 	return ok
 }
+
+// VersionedSchema is a compiled schema together with the version it was stored as.
+type VersionedSchema struct {
+	Version int
+	Schema  *jsonschema.Schema
+}
+
+// ValidateRecord runs the validation every stored record goes through: the record type's
+// schema when it has one, otherwise the minimal "userId" check. It returns nil for a valid record.
+func ValidateRecord(schema *VersionedSchema, rec map[string]interface{}) *models.RecordError {
+	if schema != nil {
+		return ValidateWithSchema(schema.Schema, rec)
+	}
+	if !IsValidRecord(rec) {
+		return models.NewRecordError(models.ErrorMissingUserID, "userId", `Missing required field "userId"`)
+	}
+	return nil
+}
+
+var schemaMessages = message.NewPrinter(language.English)
+
+// CompileSchema compiles a JSON Schema document. Schemas without "$schema" are read as draft 2020-12.
+// External references are not resolved, so a schema cannot read files or URLs from the server.
+func CompileSchema(raw []byte) (*jsonschema.Schema, error) {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.DefaultDraft(jsonschema.Draft2020)
+	compiler.UseLoader(jsonschema.SchemeURLLoader{})
+	if err := compiler.AddResource("urn:record-schema", doc); err != nil {
+		return nil, err
+	}
+	return compiler.Compile("urn:record-schema")
+}
+
+// ValidateWithSchema checks a record against a compiled schema. When the record is invalid it
+// returns an error naming the violated keyword and the JSON pointer of the value at fault.
+func ValidateWithSchema(schema *jsonschema.Schema, rec map[string]interface{}) *models.RecordError {
+	err := schema.Validate(toJSONValue(rec))
+	if err == nil {
+		return nil
+	}
+
+	verr, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return models.NewRecordError(models.ErrorSchemaViolation, "", fmt.Sprintf("Schema validation error: %v", err))
+	}
+
+	// The innermost cause is the most specific violation
+	for len(verr.Causes) > 0 {
+		verr = verr.Causes[0]
+	}
+
+	keyword := ""
+	if path := verr.ErrorKind.KeywordPath(); len(path) > 0 {
+		keyword = path[len(path)-1]
+	}
+	// A missing property is at fault rather than the object that lacks it
+	location := verr.InstanceLocation
+	if required, ok := verr.ErrorKind.(*kind.Required); ok && len(required.Missing) > 0 {
+		location = append(append([]string{}, location...), required.Missing[0])
+	}
+	reason := fmt.Sprintf("Schema violation: keyword %q at %q: %s",
+		keyword, jsonPointer(verr.InstanceLocation), verr.ErrorKind.LocalizedString(schemaMessages))
+	return models.NewRecordError(models.ErrorSchemaViolation, fieldPath(location), reason)
+}
+
+// fieldPath formats an instance location as a field path such as "items[0].sku".
+func fieldPath(location []string) string {
+	var sb strings.Builder
+	for _, token := range location {
+		if _, err := strconv.Atoi(token); err == nil && sb.Len() > 0 {
+			sb.WriteString("[" + token + "]")
+			continue
+		}
+		if sb.Len() > 0 {
+			sb.WriteString(".")
+		}
+		sb.WriteString(token)
+	}
+	return sb.String()
+}
+
+// jsonPointer formats an instance location as an RFC 6901 JSON pointer.
+func jsonPointer(location []string) string {
+	if len(location) == 0 {
+		return "/"
+	}
+	var sb strings.Builder
+	for _, token := range location {
+		token = strings.ReplaceAll(token, "~", "~0")
+		token = strings.ReplaceAll(token, "/", "~1")
+		sb.WriteString("/" + token)
+	}
+	return sb.String()
+}
+
+// toJSONValue converts parsed or stored values into the plain JSON types the schema validator
+// understands. Dates become RFC 3339 strings so they can be checked with "format": "date-time".
+func toJSONValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			out[k] = toJSONValue(item)
+		}
+		return out
+	case bson.M:
+		return toJSONValue(map[string]interface{}(val))
+	case bson.D:
+		out := make(map[string]interface{}, len(val))
+		for _, elem := range val {
+			out[elem.Key] = toJSONValue(elem.Value)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = toJSONValue(item)
+		}
+		return out
+	case bson.A:
+		return toJSONValue([]interface{}(val))
+	case []string:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = item
+		}
+		return out
+	case time.Time:
+		return val.UTC().Format(time.RFC3339Nano)
+	case primitive.DateTime:
+		return val.Time().UTC().Format(time.RFC3339Nano)
+	case primitive.ObjectID:
+		return val.Hex()
+	case nil, bool, string, float32, float64, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return val
+	default:
+		return fmt.Sprint(val)
+	}
+}
@@ -207,9 +207,14 @@ document.addEventListener("DOMContentLoaded", () => {
     const recordTypeSelect = document.getElementById("recordType");
     const selectedRecordType = recordTypeSelect.value;
   
-    // 2. Prepare the form data
-    const formData = new FormData(forms.upload);
-    formData.append("recordType", selectedRecordType); // Append extra field
+    // 2. Prepare the form data; the server streams the file, so settings go before it
+    const formData = new FormData();
+    formData.append("recordType", selectedRecordType);
+    const fileInput = forms.upload.elements["datafile"];
+    for (const [name, value] of new FormData(forms.upload)) {
+      if (name !== "datafile") formData.append(name, value);
+    }
+    if (fileInput.files.length > 0) formData.append("datafile", fileInput.files[0]);
   
     try {
       // 3. Upload with record type
@@ -219,15 +224,37 @@ document.addEventListener("DOMContentLoaded", () => {
         body: formData,
       });
   
-      const text = await response.text();
-      if (!response.ok) throw new Error(text);
+      if (!response.ok) throw new Error(await response.text());
   
-      messages.uploadResponse.textContent = text;
+      // 4. The upload runs as a background job; poll its progress
+      const job = await response.json();
+      pollUploadJob(job.id, token);
     } catch (error) {
       messages.uploadResponse.textContent = `Upload failed: ${error.message}`;
     }
   }
 
+  async function pollUploadJob(jobId, token) {
+    try {
+      const res = await fetch(`/uploads/${jobId}`, {
+        headers: { Authorization: `Bearer ${token}` },
+      });
+      if (!res.ok) throw new Error(await res.text());
+
+      const job = await res.json();
+      messages.uploadResponse.textContent =
+        `Upload ${job.status}: processed ${job.rowsProcessed} rows, ` +
+        `inserted ${job.inserted}, quarantined ${job.quarantined}.` +
+        (job.errors.length > 0 ? ` Errors: ${job.errors.join("; ")}` : "");
+
+      if (job.status === "queued" || job.status === "running") {
+        setTimeout(() => pollUploadJob(jobId, token), 1000);
+      }
+    } catch (error) {
+      messages.uploadResponse.textContent = `Failed to fetch upload status: ${error.message}`;
+    }
+  }
+
   // --- DASHBOARD CHANGES: GET DATA ---
   async function handleGetDataClick() {
     // Grab optional date strings